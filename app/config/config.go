@@ -0,0 +1,455 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	StorageMongo  = "mongo"
+	StorageMemory = "memory"
+	// redacted replaces the secrets shown by Print
+	redacted = "xxxxx"
+)
+
+// Config holds every setting of the application. Zero durations and sizes
+// stand for the defaults of the package using them, as on a Config not
+// loaded by Load.
+type Config struct {
+	Port     string   `yaml:"port"`
+	Server   Server   `yaml:"server"`
+	Storage  string   `yaml:"storage"`
+	Mongo    Mongo    `yaml:"mongo"`
+	Swapi    Swapi    `yaml:"swapi"`
+	Timeouts Timeouts `yaml:"timeouts"`
+	Limits   Limits   `yaml:"limits"`
+	// Appearances tells how often the film appearances of the planets are
+	// looked up again
+	Appearances Appearances `yaml:"appearances"`
+	Trash       Trash       `yaml:"trash"`
+	Health      Health      `yaml:"health"`
+}
+
+// Server holds the timeouts of the http server, zero ones meaning no timeout
+type Server struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	// ShutdownDelay is how long the app keeps serving requests, while not
+	// ready, once it is stopped, for load balancers to notice
+	ShutdownDelay time.Duration `yaml:"shutdownDelay"`
+	// ShutdownTimeout is how long the requests in flight have to finish when
+	// the app is stopped
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+}
+
+type Mongo struct {
+	URL          string `yaml:"url"`
+	Database     string `yaml:"database"`
+	TestDatabase string `yaml:"testDatabase"`
+	MinPoolSize  uint64 `yaml:"minPoolSize"`
+	MaxPoolSize  uint64 `yaml:"maxPoolSize"`
+	// ConnectTimeout is how long the app waits for mongo to be reachable
+	// when it starts
+	ConnectTimeout time.Duration `yaml:"connectTimeout"`
+	// AllowDegraded starts the app even if mongo can't be reached, answering
+	// the planet routes with 503 until it can
+	AllowDegraded bool `yaml:"allowDegraded"`
+	// MigrateOnStartup applies the pending migrations when the app starts
+	MigrateOnStartup bool `yaml:"migrateOnStartup"`
+}
+
+type Swapi struct {
+	URL       string        `yaml:"url"`
+	CacheTTL  time.Duration `yaml:"cacheTTL"`
+	CacheSize int           `yaml:"cacheSize"`
+}
+
+type Timeouts struct {
+	Read   time.Duration `yaml:"read"`
+	Write  time.Duration `yaml:"write"`
+	Bulk   time.Duration `yaml:"bulk"`
+	Export time.Duration `yaml:"export"`
+	Swapi  time.Duration `yaml:"swapi"`
+}
+
+type Limits struct {
+	MaxPageSize int64 `yaml:"maxPageSize"`
+	MaxBulkSize int   `yaml:"maxBulkSize"`
+	// MaxImportSize is the size, in bytes, of the largest imported file
+	MaxImportSize int64 `yaml:"maxImportSize"`
+}
+
+type Appearances struct {
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+	MaxAge          time.Duration `yaml:"maxAge"`
+}
+
+// Health tells how the readiness of the app is checked
+type Health struct {
+	// Timeout bounds each check
+	Timeout time.Duration `yaml:"timeout"`
+	// CheckSwapi probes swapi along with mongo, its failure only degrading
+	// the app as lookups fall back to their cache
+	CheckSwapi bool `yaml:"checkSwapi"`
+}
+
+type Trash struct {
+	RetentionDays int           `yaml:"retentionDays"`
+	PurgeInterval time.Duration `yaml:"purgeInterval"`
+}
+
+// Options tells where Load reads the configuration from
+type Options struct {
+	// File is a YAML file, none is read when it is empty
+	File string
+	// EnvFile is a .env file, ignored when it does not exist
+	EnvFile string
+}
+
+// Error lists every setting Load found invalid
+type Error struct {
+	Problems []string
+}
+
+func (err *Error) Error() string {
+	return "invalid configuration: " + strings.Join(err.Problems, "; ")
+}
+
+// variable is a setting read from the environment
+type variable struct {
+	name string
+	// value points to a field of the Config
+	value interface{}
+	// secret settings are redacted by Print
+	secret bool
+}
+
+// Default returns the configuration used for the settings no source sets,
+// which match the defaults of the packages the server hands them to. The
+// mongo url and database have no default.
+func Default() Config {
+	return Config{
+		Port: ":8000",
+		Server: Server{
+			ReadTimeout:       5 * time.Minute,
+			ReadHeaderTimeout: 10 * time.Second,
+			WriteTimeout:      15 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Health: Health{
+			Timeout: 2 * time.Second,
+		},
+		Storage: StorageMongo,
+		Mongo: Mongo{
+			ConnectTimeout:   30 * time.Second,
+			MigrateOnStartup: true,
+		},
+		Swapi: Swapi{
+			URL:       "https://swapi.dev/api/",
+			CacheTTL:  24 * time.Hour,
+			CacheSize: 1000,
+		},
+		Timeouts: Timeouts{
+			Read:   8 * time.Second,
+			Write:  8 * time.Second,
+			Bulk:   30 * time.Second,
+			Export: 10 * time.Minute,
+			Swapi:  5 * time.Second,
+		},
+		Limits: Limits{
+			MaxPageSize:   100,
+			MaxBulkSize:   100,
+			MaxImportSize: 10 << 20,
+		},
+		Appearances: Appearances{
+			RefreshInterval: time.Hour,
+			MaxAge:          24 * time.Hour,
+		},
+		Trash: Trash{
+			RetentionDays: 30,
+			PurgeInterval: time.Hour,
+		},
+	}
+}
+
+// Load reads the configuration, each source taking precedence over the ones
+// before it: the defaults, the YAML file, the .env file and the environment.
+// Every invalid setting is reported at once.
+func Load(options Options) (Config, error) {
+	config := Default()
+
+	if options.File != "" {
+		if err := config.readFile(options.File); err != nil {
+			return config, err
+		}
+	}
+
+	env := map[string]string{}
+	if options.EnvFile != "" {
+		values, err := godotenv.Read(options.EnvFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return config, fmt.Errorf("reading %v: %w", options.EnvFile, err)
+		}
+
+		for name, value := range values {
+			env[name] = value
+		}
+	}
+
+	problems := []string{}
+	for _, variable := range config.variables() {
+		value, ok := os.LookupEnv(variable.name)
+		if !ok {
+			value, ok = env[variable.name]
+		}
+
+		//unset and empty variables keep the value of the other sources
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := variable.set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", variable.name, err))
+		}
+	}
+
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		return config, &Error{Problems: problems}
+	}
+
+	return config, nil
+}
+
+func (config *Config) readFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return fmt.Errorf("reading %v: %w", path, err)
+	}
+
+	return nil
+}
+
+// variables maps the environment variables to the fields of the config, in
+// the order Print shows them
+func (config *Config) variables() []variable {
+	return []variable{
+		{name: "PORT", value: &config.Port},
+		{name: "HTTP_READ_TIMEOUT", value: &config.Server.ReadTimeout},
+		{name: "HTTP_READ_HEADER_TIMEOUT", value: &config.Server.ReadHeaderTimeout},
+		{name: "HTTP_WRITE_TIMEOUT", value: &config.Server.WriteTimeout},
+		{name: "HTTP_IDLE_TIMEOUT", value: &config.Server.IdleTimeout},
+		{name: "SHUTDOWN_DELAY", value: &config.Server.ShutdownDelay},
+		{name: "SHUTDOWN_TIMEOUT", value: &config.Server.ShutdownTimeout},
+		{name: "STORAGE", value: &config.Storage},
+		{name: "MONGODB_URL", value: &config.Mongo.URL, secret: true},
+		{name: "MONGODB_DATABASE", value: &config.Mongo.Database},
+		{name: "MONGODB_TEST_DATABASE", value: &config.Mongo.TestDatabase},
+		{name: "MONGODB_MIN_POOL_SIZE", value: &config.Mongo.MinPoolSize},
+		{name: "MONGODB_MAX_POOL_SIZE", value: &config.Mongo.MaxPoolSize},
+		{name: "MONGODB_CONNECT_TIMEOUT", value: &config.Mongo.ConnectTimeout},
+		{name: "MONGODB_ALLOW_DEGRADED", value: &config.Mongo.AllowDegraded},
+		{name: "MIGRATE_ON_STARTUP", value: &config.Mongo.MigrateOnStartup},
+		{name: "SWAPI_URL", value: &config.Swapi.URL},
+		{name: "SWAPI_CACHE_TTL", value: &config.Swapi.CacheTTL},
+		{name: "SWAPI_CACHE_SIZE", value: &config.Swapi.CacheSize},
+		{name: "READ_TIMEOUT", value: &config.Timeouts.Read},
+		{name: "WRITE_TIMEOUT", value: &config.Timeouts.Write},
+		{name: "BULK_TIMEOUT", value: &config.Timeouts.Bulk},
+		{name: "EXPORT_TIMEOUT", value: &config.Timeouts.Export},
+		{name: "SWAPI_TIMEOUT", value: &config.Timeouts.Swapi},
+		{name: "MAX_PAGE_SIZE", value: &config.Limits.MaxPageSize},
+		{name: "MAX_BULK_SIZE", value: &config.Limits.MaxBulkSize},
+		{name: "MAX_IMPORT_SIZE", value: &config.Limits.MaxImportSize},
+		{name: "APPEARANCES_REFRESH_INTERVAL", value: &config.Appearances.RefreshInterval},
+		{name: "APPEARANCES_MAX_AGE", value: &config.Appearances.MaxAge},
+		{name: "TRASH_RETENTION_DAYS", value: &config.Trash.RetentionDays},
+		{name: "TRASH_PURGE_INTERVAL", value: &config.Trash.PurgeInterval},
+		{name: "HEALTH_TIMEOUT", value: &config.Health.Timeout},
+		{name: "HEALTH_CHECK_SWAPI", value: &config.Health.CheckSwapi},
+	}
+}
+
+func (variable variable) set(value string) error {
+	var err error
+
+	switch field := variable.value.(type) {
+	case *string:
+		*field = value
+	case *bool:
+		*field, err = strconv.ParseBool(value)
+	case *int:
+		*field, err = strconv.Atoi(value)
+	case *int64:
+		*field, err = strconv.ParseInt(value, 10, 64)
+	case *uint64:
+		*field, err = strconv.ParseUint(value, 10, 64)
+	case *time.Duration:
+		*field, err = time.ParseDuration(value)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %v", value, variable.kind())
+	}
+
+	return nil
+}
+
+func (variable variable) kind() string {
+	switch variable.value.(type) {
+	case *bool:
+		return "boolean"
+	case *time.Duration:
+		return "duration"
+	case *uint64:
+		return "positive number"
+	}
+
+	return "number"
+}
+
+func (variable variable) String() string {
+	if duration, ok := variable.value.(*time.Duration); ok {
+		return duration.String()
+	}
+
+	value := fmt.Sprint(dereference(variable.value))
+	if variable.secret {
+		return redact(value)
+	}
+
+	return value
+}
+
+func dereference(value interface{}) interface{} {
+	switch field := value.(type) {
+	case *string:
+		return *field
+	case *bool:
+		return *field
+	case *int:
+		return *field
+	case *int64:
+		return *field
+	case *uint64:
+		return *field
+	}
+
+	return value
+}
+
+func (config *Config) validate() []string {
+	problems := []string{}
+
+	if _, port, err := net.SplitHostPort(config.Port); err != nil {
+		problems = append(problems, fmt.Sprintf("PORT: %q must be like :8000", config.Port))
+	} else if number, err := strconv.Atoi(port); err != nil || number < 0 || number > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT: %q is not a valid port", port))
+	}
+
+	//the response of an export is written for as long as the export takes
+	export := config.Timeouts.Export
+	if export == 0 {
+		export = Default().Timeouts.Export
+	}
+
+	if config.Server.WriteTimeout > 0 && config.Server.WriteTimeout <= export {
+		problems = append(problems, "HTTP_WRITE_TIMEOUT: must be longer than EXPORT_TIMEOUT")
+	}
+
+	if config.Storage != StorageMongo && config.Storage != StorageMemory {
+		problems = append(problems, fmt.Sprintf("STORAGE: must be %v or %v", StorageMongo, StorageMemory))
+	}
+
+	if config.Storage == StorageMongo {
+		if !strings.HasPrefix(config.Mongo.URL, "mongodb://") && !strings.HasPrefix(config.Mongo.URL, "mongodb+srv://") {
+			problems = append(problems, "MONGODB_URL: must start with mongodb:// or mongodb+srv://")
+		}
+
+		if config.Mongo.Database == "" {
+			problems = append(problems, "MONGODB_DATABASE: is required")
+		}
+
+		//with no timeout the app would wait for an unreachable mongo forever
+		if config.Mongo.ConnectTimeout == 0 {
+			problems = append(problems, "MONGODB_CONNECT_TIMEOUT: must be positive")
+		}
+	}
+
+	if config.Mongo.MaxPoolSize > 0 && config.Mongo.MinPoolSize > config.Mongo.MaxPoolSize {
+		problems = append(problems, "MONGODB_MIN_POOL_SIZE: must not be greater than MONGODB_MAX_POOL_SIZE")
+	}
+
+	if config.Swapi.URL != "" {
+		if u, err := url.Parse(config.Swapi.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("SWAPI_URL: %q is not an absolute url", config.Swapi.URL))
+		}
+	}
+
+	//durations and sizes may be left to their defaults, but not be negative
+	for _, variable := range config.variables() {
+		negative := false
+
+		switch field := variable.value.(type) {
+		case *int:
+			negative = *field < 0
+		case *int64:
+			negative = *field < 0
+		case *time.Duration:
+			negative = *field < 0
+		}
+
+		if negative {
+			problems = append(problems, fmt.Sprintf("%v: must not be negative", variable.name))
+		}
+	}
+
+	return problems
+}
+
+// Print writes the configuration to w as environment variables, with the
+// passwords of the urls redacted
+func (config Config) Print(w io.Writer) error {
+	for _, variable := range config.variables() {
+		if _, err := fmt.Fprintf(w, "%v=%v\n", variable.name, variable); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// redact hides the password of a url, or the whole url when it can't be parsed
+func redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return redacted
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	return u.String()
+}
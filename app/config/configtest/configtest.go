@@ -0,0 +1,44 @@
+// Package configtest holds the configuration of the automated tests
+package configtest
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Azuos0/b2w_challenge/app/config"
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/server"
+)
+
+// Config loads the configuration of the automated tests, from the
+// environment and the .env file at the root of the project, pointing it to
+// the test database. Invalid settings are left for the tests to fail on.
+func Config() config.Config {
+	envFile := ".env"
+
+	//tests run from the directory of their package, the root is where go.mod is
+	if dir, err := os.Getwd(); err == nil {
+		for {
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				envFile = filepath.Join(dir, ".env")
+				break
+			}
+
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+
+	settings, _ := config.Load(config.Options{EnvFile: envFile})
+	settings.Mongo.Database = settings.Mongo.TestDatabase
+
+	return settings
+}
+
+// Mongo are the settings of the test database
+func Mongo() database.Settings {
+	return server.MongoSettings(Config().Mongo)
+}
@@ -0,0 +1,23 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireDatabase answers every request with a 503 problem, without reaching
+// the handlers, for as long as unavailable reports the database can't be
+// reached
+func RequireDatabase(unavailable func() bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if unavailable() {
+				respondWithProblem(w, r, newProblem(http.StatusServiceUnavailable, problemUpstream, "the database is unavailable, try again later"))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Azuos0/b2w_challenge/app/services"
+)
+
+// maxBulkItemSize bounds, in bytes, each planet sent at once, so the body of
+// a bulk creation is bounded by the planets it may hold
+const maxBulkItemSize = 8 << 10
+
+var errNotAnArray = errors.New("the body must be an array of planets")
+
+// readBulkItems reads the planets of a JSON array one at a time, failing with
+// ErrBulkTooLarge as soon as there are more than max of them, unless max is 0
+func readBulkItems(body io.Reader, max int) ([]json.RawMessage, error) {
+	decoder := json.NewDecoder(body)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	if token != json.Delim('[') {
+		return nil, errNotAnArray
+	}
+
+	items := []json.RawMessage{}
+	for decoder.More() {
+		if max > 0 && len(items) == max {
+			return nil, &services.ErrBulkTooLarge{Max: max}
+		}
+
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	//the closing bracket, and nothing after it
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errNotAnArray
+	}
+
+	return items, nil
+}
+
+// limitBody caps the body of r at max bytes with http.MaxBytesReader, which
+// closes the connection instead of reading the rest of a larger body. Reading
+// past max fails with tooLarge.
+func limitBody(w http.ResponseWriter, r *http.Request, max int64, tooLarge error) {
+	r.Body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, max), max: max, tooLarge: tooLarge}
+}
+
+// limitedBody tells the error of reading past its limit apart from the other
+// errors of reading a body
+type limitedBody struct {
+	io.ReadCloser
+	max, read int64
+	tooLarge  error
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.read += int64(n)
+
+	//MaxBytesReader fails once max bytes were read and there are more
+	if err != nil && err != io.EOF && body.read >= body.max {
+		err = body.tooLarge
+	}
+
+	return n, err
+}
@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/utils"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header with the ETag of the planet is required")
+	errMalformedIfMatch     = errors.New("If-Match must be * or a list of ETags of the planet")
+)
+
+// etag is the entity tag of the planet at its current version
+func etag(planet *models.Planet) string {
+	return fmt.Sprintf(`"%d"`, planet.Version)
+}
+
+// respondWithPlanet sends the planet along with its ETag
+func respondWithPlanet(w http.ResponseWriter, code int, planet *models.Planet) {
+	w.Header().Set("ETag", etag(planet))
+	utils.RespondWithJSON(w, code, planet)
+}
+
+// ifMatch returns the planet versions accepted by the If-Match header, nil
+// meaning any version. A missing header is only accepted when not required.
+// Following RFC 7232 the tags are compared with the strong comparison, so weak
+// tags never match and a header with only those fails the precondition.
+func ifMatch(r *http.Request, required bool) ([]int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+
+	if value == "" {
+		if required {
+			return nil, errPreconditionRequired
+		}
+		return nil, nil
+	}
+
+	if value == "*" {
+		return nil, nil
+	}
+
+	tags, ok := parseETags(value)
+	if !ok {
+		return nil, errMalformedIfMatch
+	}
+
+	versions := []int64{}
+	for _, tag := range tags {
+		if version, ok := planetVersion(tag); ok && !tag.weak {
+			versions = append(versions, version)
+		}
+	}
+
+	if len(versions) == 0 {
+		return nil, services.ErrVersionMismatch
+	}
+
+	return versions, nil
+}
+
+// matchVersion runs write with each version accepted by the If-Match header
+// until one of them is the current version of the planet. The versions are
+// checked by the write itself, so the planet can not change in between.
+func matchVersion(versions []int64, write func(version int64) error) error {
+	if versions == nil {
+		return write(0)
+	}
+
+	var err error
+	for _, version := range versions {
+		err = write(version)
+		if !errors.Is(err, services.ErrVersionMismatch) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// noneMatch tells whether the If-None-Match header matches the planet, using
+// the weak comparison, so its representation does not need to be sent again
+func noneMatch(r *http.Request, planet *models.Planet) bool {
+	value := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if value == "" {
+		return false
+	}
+
+	if value == "*" {
+		return true
+	}
+
+	tags, _ := parseETags(value)
+	for _, tag := range tags {
+		version, ok := planetVersion(tag)
+		if ok && version == planet.Version {
+			return true
+		}
+	}
+
+	return false
+}
+
+type entityTag struct {
+	opaque string
+	weak   bool
+}
+
+// parseETags reads a comma separated list of entity tags such as "3", W/"2",
+// failing when any of them is not an entity tag
+func parseETags(value string) ([]entityTag, bool) {
+	tags := []entityTag{}
+
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+
+		weak := strings.HasPrefix(tag, "W/")
+		tag = strings.TrimPrefix(tag, "W/")
+
+		if len(tag) < 2 || !strings.HasPrefix(tag, `"`) || !strings.HasSuffix(tag, `"`) {
+			return nil, false
+		}
+
+		opaque := tag[1 : len(tag)-1]
+		if strings.Contains(opaque, `"`) {
+			return nil, false
+		}
+
+		tags = append(tags, entityTag{opaque: opaque, weak: weak})
+	}
+
+	return tags, len(tags) > 0
+}
+
+// planetVersion reads the version of an entity tag such as "3", tags that are
+// not a version of a planet never matching it
+func planetVersion(tag entityTag) (int64, bool) {
+	version, err := strconv.ParseInt(tag.opaque, 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/utils"
+)
+
+// The states reported by the health endpoints
+const (
+	HealthOK           = "ok"
+	HealthDegraded     = "degraded"
+	HealthUnavailable  = "unavailable"
+	HealthShuttingDown = "shutting_down"
+)
+
+// defaultHealthTimeout bounds the checks of a HealthController without Timeout
+const defaultHealthTimeout = 2 * time.Second
+
+// HealthCheck probes a dependency of the app
+type HealthCheck struct {
+	Name string
+	// Critical checks make the app not ready when they fail, the others only
+	// degrade it
+	Critical bool
+	Check    func(ctx context.Context) error
+	// Details describes the dependency whatever the outcome of Check, e.g. the
+	// hits and misses of the swapi cache. It may be nil.
+	Details func() interface{}
+}
+
+// CheckResult is the outcome of a HealthCheck. Errors are only logged, so no
+// internal message reaches the client.
+type CheckResult struct {
+	Status    string      `json:"status"`
+	Critical  bool        `json:"critical"`
+	LatencyMs float64     `json:"latencyMs"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type HealthController struct {
+	Checks []HealthCheck
+	// ShuttingDown tells whether the app is shutting down, which makes it not
+	// ready whatever the checks say
+	ShuttingDown func() bool
+	// Timeout bounds each check
+	Timeout time.Duration
+}
+
+// Live tells the process is up and serving requests, without checking any
+// dependency
+func (controller *HealthController) Live() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		utils.RespondWithJSON(w, http.StatusOK, HealthResponse{Status: HealthOK})
+	}
+}
+
+// Ready runs every check at once, answering 503 when a critical one fails or
+// the app is shutting down. Failing checks that are not critical still answer
+// 200, with the app reported as degraded.
+func (controller *HealthController) Ready() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if controller.ShuttingDown != nil && controller.ShuttingDown() {
+			utils.RespondWithJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: HealthShuttingDown})
+			return
+		}
+
+		response := HealthResponse{Status: HealthOK, Checks: controller.check(r.Context())}
+
+		code := http.StatusOK
+		for _, result := range response.Checks {
+			if result.Status == HealthOK {
+				continue
+			}
+
+			if result.Critical {
+				response.Status = HealthUnavailable
+				code = http.StatusServiceUnavailable
+			} else if response.Status == HealthOK {
+				response.Status = HealthDegraded
+			}
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		utils.RespondWithJSON(w, code, response)
+	}
+}
+
+func (controller *HealthController) check(ctx context.Context) map[string]CheckResult {
+	timeout := controller.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+
+	results := make(map[string]CheckResult, len(controller.Checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, check := range controller.Checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Check(checkCtx)
+			result := CheckResult{
+				Status:    HealthOK,
+				Critical:  check.Critical,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+
+			if check.Details != nil {
+				result.Details = check.Details()
+			}
+
+			if err != nil {
+				log.Printf("health check %v: %v", check.Name, err)
+
+				result.Status = HealthUnavailable
+				result.Error = "unreachable"
+				if errors.Is(err, context.DeadlineExceeded) {
+					result.Error = "timed out"
+				}
+			}
+
+			mu.Lock()
+			results[check.Name] = result
+			mu.Unlock()
+		}(check)
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,120 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/controller"
+	"github.com/stretchr/testify/require"
+)
+
+func passing(ctx context.Context) error {
+	return nil
+}
+
+func failing(ctx context.Context) error {
+	return errors.New("connection refused by mongodb:27017")
+}
+
+func hanging(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func checkHealth(t *testing.T, handler http.HandlerFunc) (int, controller.HealthResponse) {
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	res := httptest.NewRecorder()
+	handler(res, req)
+
+	var health controller.HealthResponse
+	require.Nil(t, json.Unmarshal(res.Body.Bytes(), &health))
+
+	return res.Code, health
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	for _, path := range []string{"/healthz", "/readyz"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		response := executeRequest(req)
+
+		require.Equal(t, http.StatusOK, response.Code)
+		require.Contains(t, response.Body.String(), `"status":"ok"`)
+	}
+}
+
+func TestReady(t *testing.T) {
+	health := controller.HealthController{Checks: []controller.HealthCheck{
+		{Name: "mongo", Critical: true, Check: passing},
+		{Name: "swapi", Check: passing},
+	}}
+
+	code, res := checkHealth(t, health.Ready())
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, controller.HealthOK, res.Status)
+	require.Len(t, res.Checks, 2)
+	require.Equal(t, controller.HealthOK, res.Checks["mongo"].Status)
+	require.True(t, res.Checks["mongo"].Critical)
+	require.GreaterOrEqual(t, res.Checks["mongo"].LatencyMs, 0.0)
+	require.Nil(t, res.Checks["mongo"].Details)
+}
+
+func TestReadyReportsCheckDetails(t *testing.T) {
+	health := controller.HealthController{Checks: []controller.HealthCheck{
+		{Name: "swapi", Check: failing, Details: func() interface{} {
+			return map[string]int{"hits": 3, "misses": 1}
+		}},
+	}}
+
+	_, res := checkHealth(t, health.Ready())
+
+	require.Equal(t, map[string]interface{}{"hits": 3.0, "misses": 1.0}, res.Checks["swapi"].Details)
+}
+
+func TestReadyWithFailingChecks(t *testing.T) {
+	//a check that is not critical only degrades the app
+	health := controller.HealthController{Checks: []controller.HealthCheck{
+		{Name: "mongo", Critical: true, Check: passing},
+		{Name: "swapi", Check: failing},
+	}}
+
+	code, res := checkHealth(t, health.Ready())
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, controller.HealthDegraded, res.Status)
+	require.Equal(t, controller.HealthUnavailable, res.Checks["swapi"].Status)
+	require.Equal(t, "unreachable", res.Checks["swapi"].Error)
+
+	//a critical one makes it unavailable, without leaking its error
+	health.Checks[0].Check = hanging
+	health.Timeout = 20 * time.Millisecond
+
+	code, res = checkHealth(t, health.Ready())
+
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, controller.HealthUnavailable, res.Status)
+	require.Equal(t, "timed out", res.Checks["mongo"].Error)
+}
+
+func TestNotReadyWhileShuttingDown(t *testing.T) {
+	health := controller.HealthController{
+		Checks:       []controller.HealthCheck{{Name: "mongo", Critical: true, Check: passing}},
+		ShuttingDown: func() bool { return true },
+	}
+
+	code, res := checkHealth(t, health.Ready())
+
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, controller.HealthShuttingDown, res.Status)
+
+	//the process is still alive
+	code, res = checkHealth(t, health.Live())
+
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, controller.HealthOK, res.Status)
+}
@@ -1,13 +1,16 @@
 package controller
 
 import (
-	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"log"
+	"mime"
 	"net/http"
 	"strconv"
 
 	"github.com/Azuos0/b2w_challenge/app/models"
 	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
 	"github.com/Azuos0/b2w_challenge/app/utils"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -21,35 +24,108 @@ func (c *PlanetController) SetService(db *mongo.Database) {
 	c.PlanetService = services.NewPlanetService(db)
 }
 
+func (c *PlanetController) SetRepository(repository services.PlanetRepository, swapiClient swapi.Client) {
+	c.PlanetService = services.NewPlanetServiceWithRepository(repository, swapiClient)
+}
+
 func (controller *PlanetController) CreatePlanet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		planet := models.Planet{}
-
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBadRequest(w, r, "the body could not be read")
+			return
+		}
+
+		planet, err := models.DecodePlanet(body)
+		if err != nil {
+			respondWithError(w, r, services.NewErrValidation(err))
 			return
 		}
 
-		err = json.Unmarshal(body, &planet)
+		res, err := controller.service(r).Create(r.Context(), planet)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusCreated, res)
+	}
+}
+
+// BulkCreatePlanets creates the planets of an array at once, answering with
+// the outcome of each one instead of failing them all. The array is read one
+// planet at a time, up to the MaxBulkSize of the service.
+func (controller *PlanetController) BulkCreatePlanets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		service := controller.service(r)
+
+		if service.MaxBulkSize > 0 {
+			limitBody(w, r, int64(service.MaxBulkSize)*maxBulkItemSize, &services.ErrBulkTooLarge{Max: service.MaxBulkSize})
+		}
+
+		items, err := readBulkItems(r.Body, service.MaxBulkSize)
+
+		var tooLarge *services.ErrBulkTooLarge
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, r, err)
 			return
 		}
 
-		err = planet.Validate()
 		if err != nil {
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithBadRequest(w, r, errNotAnArray.Error())
 			return
 		}
 
-		res, err := controller.PlanetService.Create(planet)
+		res, err := service.BulkCreate(r.Context(), items)
 		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, err)
 			return
 		}
 
-		utils.RespondWithJSON(w, http.StatusCreated, res)
+		utils.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+// ImportPlanets creates the planets of a CSV or NDJSON file, read as it is
+// uploaded, or only checks them when dryRun is true
+func (controller *PlanetController) ImportPlanets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var format string
+
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = services.FormatCSV
+		case "application/x-ndjson", "application/ndjson":
+			format = services.FormatNDJSON
+		default:
+			respondWithProblem(w, r, newProblem(http.StatusUnsupportedMediaType, problemUnsupportedMediaType, "Content-Type must be text/csv or application/x-ndjson"))
+			return
+		}
+
+		dryRun := false
+		if value := r.URL.Query().Get("dryRun"); value != "" {
+			var err error
+			dryRun, err = strconv.ParseBool(value)
+			if err != nil {
+				respondWithBadRequest(w, r, "dryRun must be true or false")
+				return
+			}
+		}
+
+		service := controller.service(r)
+		if service.MaxImportSize > 0 {
+			//Import reads a byte past its limit to tell the file is too large
+			r.Body = http.MaxBytesReader(w, r.Body, service.MaxImportSize+1)
+		}
+
+		res, err := service.Import(r.Context(), r.Body, format, dryRun)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, res)
 	}
 }
 
@@ -58,39 +134,260 @@ func (controller *PlanetController) GetPlanet() http.HandlerFunc {
 		params := mux.Vars(r)
 		id := params["id"]
 
-		res, err := controller.PlanetService.Get(id)
+		res, err := controller.PlanetService.Get(r.Context(), id)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				utils.RespondWithError(w, http.StatusNotFound, err.Error())
-				return
-			}
+			respondWithError(w, r, err)
+			return
+		}
 
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+		if noneMatch(r, res) {
+			w.Header().Set("ETag", etag(res))
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 
-		utils.RespondWithJSON(w, http.StatusOK, res)
+		respondWithPlanet(w, http.StatusOK, res)
+	}
+}
+
+func (controller *PlanetController) UpdatePlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		versions, err := ifMatch(r, true)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			respondWithBadRequest(w, r, "the body could not be read")
+			return
+		}
+
+		planet, err := models.DecodePlanet(body)
+		if err != nil {
+			respondWithError(w, r, services.NewErrValidation(err))
+			return
+		}
+
+		var res *models.Planet
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.service(r).Update(r.Context(), id, planet, version)
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusOK, res)
+	}
+}
+
+func (controller *PlanetController) PatchPlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		versions, err := ifMatch(r, true)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			respondWithBadRequest(w, r, "the body could not be read")
+			return
+		}
+
+		var res *models.Planet
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.service(r).Patch(r.Context(), id, body, version)
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusOK, res)
+	}
+}
+
+func (controller *PlanetController) RefreshPlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		versions, err := ifMatch(r, true)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		var res *models.Planet
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.PlanetService.Refresh(r.Context(), id, version)
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusOK, res)
 	}
 }
 
 func (controller *PlanetController) Search() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		name := r.URL.Query().Get("name")
-		page := r.URL.Query().Get("page")
-
-		var searchPage int64 = 1
-		var err error
-		
-		if page != "" {
-			searchPage, err = strconv.ParseInt(page, 10, 32)
+		controller.search(w, r, false)
+	}
+}
+
+// Trash lists the deleted planets that were not purged yet, taking the same
+// params as Search
+func (controller *PlanetController) Trash() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		controller.search(w, r, true)
+	}
+}
+
+// exportTypes are the Content-Type and file extension of each export format
+var exportTypes = map[string]struct{ contentType, extension string }{
+	services.FormatCSV:    {"text/csv; charset=utf-8", "csv"},
+	services.FormatNDJSON: {"application/x-ndjson", "ndjson"},
+	services.FormatJSON:   {"application/json", "json"},
+}
+
+// ExportPlanets streams the planets matching the Search filters as a CSV,
+// NDJSON or JSON (the default) file download
+func (controller *PlanetController) ExportPlanets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = services.FormatJSON
+		}
+
+		exportType, ok := exportTypes[format]
+		if !ok {
+			respondWithBadRequest(w, r, "format must be csv, ndjson or json")
+			return
+		}
+
+		filter, err := parseSearchFilter(r.URL.Query())
+		if err != nil {
+			respondWithQueryError(w, r, err)
+			return
+		}
+
+		pagination, err := parsePagination(r.URL.Query())
+		if err != nil {
+			respondWithBadRequest(w, r, err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", exportType.contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": "planets." + exportType.extension,
+		}))
+
+		res, err := controller.PlanetService.Export(r.Context(), w, format, filter, pagination.Sort)
+		if err != nil {
+			//once the file began to be written the status can't change
+			//anymore, and the truncated file is all the client gets
+			if res.Written {
+				log.Printf("export interrupted after %v planets: %v", res.Planets, err)
+				return
+			}
+
+			w.Header().Del("Content-Disposition")
+			respondWithError(w, r, err)
+		}
+	}
+}
+
+func (controller *PlanetController) search(w http.ResponseWriter, r *http.Request, deleted bool) {
+	page := r.URL.Query().Get("page")
+
+	var searchPage int64 = 1
+	var err error
+	
+	if page != "" {
+		searchPage, err = strconv.ParseInt(page, 10, 32)
+		if err != nil {
+			searchPage = 1
+		}
+	}
+
+	filter, err := parseSearchFilter(r.URL.Query())
+	if err != nil {
+		respondWithQueryError(w, r, err)
+		return
+	}
+	filter.Deleted = deleted
+
+	pagination, err := parsePagination(r.URL.Query())
+	if err != nil {
+		respondWithBadRequest(w, r, err.Error())
+		return
+	}
+	pagination.Page = searchPage
+
+	var res *services.SearchResponse
+
+	//the cursor param, even if empty, switches to cursor pagination
+	if _, ok := r.URL.Query()["cursor"]; ok {
+		var cursor *services.Cursor
+
+		if page != "" || len(pagination.Sort) > 0 {
+			respondWithBadRequest(w, r, "cursor cannot be used with page or sort")
+			return
+		}
+
+		if value := r.URL.Query().Get("cursor"); value != "" {
+			cursor, err = services.DecodeCursor(value)
 			if err != nil {
-				searchPage = 1
+				respondWithBadRequest(w, r, err.Error())
+				return
 			}
 		}
 
-		res, err := controller.PlanetService.Search(searchPage, name)
+		res, err = controller.PlanetService.SearchByCursor(r.Context(), filter, cursor, pagination.PerPage)
+	} else {
+		res, err = controller.PlanetService.Search(r.Context(), filter, pagination)
+	}
+
+	if err != nil {
+		respondWithError(w, r, err)
+		return
+	}
+
+	utils.RespondWithJSON(w, http.StatusOK, res)
+}
+
+func (controller *PlanetController) DeletePlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		versions, err := ifMatch(r, true)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		var res string
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.service(r).Delete(r.Context(), id, version)
+			return err
+		})
 		if err != nil {
-			utils.RespondWithError(w, http.StatusInternalServerError, err.Error())
+			respondWithError(w, r, err)
 			return
 		}
 
@@ -98,21 +395,100 @@ func (controller *PlanetController) Search() http.HandlerFunc {
 	}
 }
 
-func (controller *PlanetController) DeletePlanet() http.HandlerFunc {
+func (controller *PlanetController) RestorePlanet() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
 		id := params["id"]
 
-		res, err := controller.PlanetService.Delete(id)
+		versions, err := ifMatch(r, true)
 		if err != nil {
-			if err.Error() == "no planet with this id was found in this so far far away galaxy" {
-				utils.RespondWithError(w, http.StatusNotFound, err.Error())
-				return
-			}
-			utils.RespondWithError(w, http.StatusBadRequest, err.Error())
+			respondWithError(w, r, err)
+			return
+		}
+
+		var res *models.Planet
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.service(r).Restore(r.Context(), id, version)
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusOK, res)
+	}
+}
+
+func (controller *PlanetController) History() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		res, err := controller.PlanetService.History(r.Context(), id)
+		if err != nil {
+			respondWithError(w, r, err)
 			return
 		}
 
 		utils.RespondWithJSON(w, http.StatusOK, res)
 	}
 }
+
+func (controller *PlanetController) GetRevision() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		rev, err := strconv.Atoi(params["rev"])
+		if err != nil {
+			respondWithBadRequest(w, r, "rev must be a revision number")
+			return
+		}
+
+		res, err := controller.PlanetService.Revision(r.Context(), id, rev)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		utils.RespondWithJSON(w, http.StatusOK, res)
+	}
+}
+
+func (controller *PlanetController) RevertPlanet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		id := params["id"]
+
+		rev, err := strconv.Atoi(params["rev"])
+		if err != nil {
+			respondWithBadRequest(w, r, "rev must be a revision number")
+			return
+		}
+
+		versions, err := ifMatch(r, true)
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		var res *models.Planet
+		err = matchVersion(versions, func(version int64) (err error) {
+			res, err = controller.service(r).Revert(r.Context(), id, rev, version)
+			return err
+		})
+		if err != nil {
+			respondWithError(w, r, err)
+			return
+		}
+
+		respondWithPlanet(w, http.StatusOK, res)
+	}
+}
+
+// service records the author sent on the X-Author header on the revisions
+// of the changes made by the request
+func (controller *PlanetController) service(r *http.Request) *services.PlanetService {
+	return controller.PlanetService.WithAuthor(r.Header.Get("X-Author"))
+}
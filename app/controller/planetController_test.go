@@ -4,54 +4,77 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
-	"time"
 
+	"github.com/Azuos0/b2w_challenge/app/config"
+	"github.com/Azuos0/b2w_challenge/app/controller"
+	"github.com/Azuos0/b2w_challenge/app/database"
 	"github.com/Azuos0/b2w_challenge/app/models"
 	"github.com/Azuos0/b2w_challenge/app/server"
 	"github.com/Azuos0/b2w_challenge/app/services"
-	"github.com/joho/godotenv"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/Azuos0/b2w_challenge/app/swapi/swapitest"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 var app server.App
 
+// init keeps the planets in memory, unless MONGODB_TEST_URL points to a mongo
+// whose test database, named after MONGODB_TEST_DATABASE, can be emptied
 func init() {
-	if os.Getenv("PORT") == "" {
-		err := godotenv.Load("../../.env")
+	app.Config = config.Default()
+	app.Swapi = swapi.NewClient(swapitest.NewServer().URL, nil)
 
-		if err != nil {
-			log.Fatalf("Error loading .env file")
-		}
+	url := os.Getenv("MONGODB_TEST_URL")
+	if url == "" {
+		app.InitializeInMemoryApp()
+		return
+	}
+
+	app.Config.Mongo.URL = url
+	app.Config.Mongo.Database = os.Getenv("MONGODB_TEST_DATABASE")
+	if app.Config.Mongo.Database == "" {
+		app.Config.Mongo.Database = "swapp_test"
 	}
 
-	uri := os.Getenv("MONGODB_TEST_DATABASE")
-	app.InitializeApp(uri)
+	if err := app.InitializeApp(); err != nil {
+		panic(err)
+	}
 }
 
 func clearDatabase() {
-	planetService := services.NewPlanetService(app.DB)
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	planetService.Collection.Drop(ctx)
-	defer cancel()
+	if repository, ok := app.Planets.(*services.MemoryPlanetRepository); ok {
+		repository.Clear()
+		return
+	}
+
+	//the documents are removed, keeping the indexes of the migrations
+	for _, collection := range []string{"planets", "planet_revisions"} {
+		database.GetCollection(app.DB, collection).DeleteMany(context.Background(), bson.M{})
+	}
 }
 
 func addMockPlanet(planet models.Planet) string {
-	planetService := services.NewPlanetService(app.DB)
-	mockedPlanet, _ := planetService.Create(planet)
+	planetService := services.NewPlanetServiceWithRepository(app.Planets, app.Swapi)
+	planetService.Revisions = app.Revisions
+	mockedPlanet, _ := planetService.Create(context.Background(), planet)
 
 	return mockedPlanet.ID.Hex()
 }
 
 func addMockPlanet2(planet models.Planet) *models.Planet {
-	planetService := services.NewPlanetService(app.DB)
-	mockedPlanet, _ := planetService.Create(planet)
+	planetService := services.NewPlanetServiceWithRepository(app.Planets, app.Swapi)
+	planetService.Revisions = app.Revisions
+	mockedPlanet, _ := planetService.Create(context.Background(), planet)
 
 	return mockedPlanet
 }
@@ -101,11 +124,15 @@ func TestCreateInvalidPlanet(t *testing.T) {
 	response := executeRequest(req)
 
 	require.Equal(t, http.StatusBadRequest, response.Code)
+	require.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
 
-	var m map[string]string
-	json.Unmarshal(response.Body.Bytes(), &m)
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
 
-	require.Equal(t, "terrain: Missing required field", m["error"])
+	require.Equal(t, "/problems/validation", problem.Type)
+	require.Equal(t, http.StatusBadRequest, problem.Status)
+	require.Equal(t, "/api/planet", problem.Instance)
+	require.Equal(t, []controller.InvalidParam{{Name: "terrain", Reason: "Missing required field"}}, problem.InvalidParams)
 
 	clearDatabase()
 }
@@ -143,6 +170,7 @@ func TestDeleteExistentPlanet(t *testing.T) {
 	url := fmt.Sprintf("/api/planet/%v", id)
 
 	req, _ := http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `"1"`)
 	response := executeRequest(req)
 
 	var m string
@@ -163,10 +191,12 @@ func TestGetNonExistentPlanet(t *testing.T) {
 
 	require.Equal(t, http.StatusNotFound, response.Code)
 
-	var m map[string]string
-	json.Unmarshal(response.Body.Bytes(), &m)
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
 
-	require.Equal(t, "mongo: no documents in result", m["error"])
+	require.Equal(t, "not-found", problem.Code)
+	require.Equal(t, "no planet with this id was found in this so far far away galaxy", problem.Detail)
+	require.Equal(t, url, problem.Instance)
 }
 
 func TestDeleteNonExistentPlanet(t *testing.T) {
@@ -174,14 +204,16 @@ func TestDeleteNonExistentPlanet(t *testing.T) {
 	url := fmt.Sprintf("/api/planet/%v", id)
 
 	req, _ := http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `"1"`)
 	response := executeRequest(req)
 
 	require.Equal(t, http.StatusNotFound, response.Code)
 
-	var m map[string]string
-	json.Unmarshal(response.Body.Bytes(), &m)
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
 
-	require.Equal(t, "no planet with this id was found in this so far far away galaxy", m["error"])
+	require.Equal(t, "not-found", problem.Code)
+	require.Equal(t, "no planet with this id was found in this so far far away galaxy", problem.Detail)
 }
 
 func TestSearchNonExistentPlanet(t *testing.T) {
@@ -257,3 +289,811 @@ func TestListPagination(t *testing.T) {
 
 	clearDatabase()
 }
+
+func TestUpdateExistentPlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Terrain: "Desert",
+		Climate: "Arid",
+	}
+
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	var jsonStr = []byte(`{
+		"name": "Tatooine",
+		"climate": "temperate",
+		"terrain": "desert"
+	}`)
+
+	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Content-Type", "application/json")
+	response := executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, id, m["_id"])
+	require.Equal(t, "temperate", m["climate"])
+
+	clearDatabase()
+}
+
+func TestUpdateInvalidPlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Terrain: "Desert",
+		Climate: "Arid",
+	}
+
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	var jsonStr = []byte(`{
+		"name": "Tatooine",
+		"climate": "temperate"
+	}`)
+
+	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Content-Type", "application/json")
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	clearDatabase()
+}
+
+func TestUpdateNonExistentPlanet(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	var jsonStr = []byte(`{
+		"name": "Tatooine",
+		"climate": "arid",
+		"terrain": "desert"
+	}`)
+
+	req, _ := http.NewRequest("PUT", url, bytes.NewBuffer(jsonStr))
+	req.Header.Set("If-Match", `"1"`)
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestPatchExistentPlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Terrain: "Desert",
+		Climate: "Arid",
+	}
+
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	req, _ := http.NewRequest("PATCH", url, bytes.NewBuffer([]byte(`{"climate": "temperate"}`)))
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	response := executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "Tatooine", m["name"])
+	require.Equal(t, "temperate", m["climate"])
+	require.Equal(t, "desert", m["terrain"])
+
+	clearDatabase()
+}
+
+func TestRefreshExistentPlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Terrain: "Desert",
+		Climate: "Arid",
+	}
+
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v/refresh", id)
+
+	req, _ := http.NewRequest("POST", url, nil)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusPreconditionRequired, response.Code)
+
+	req.Header.Set("If-Match", `"2"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusPreconditionFailed, response.Code)
+
+	req.Header.Set("If-Match", `"1"`)
+	response = executeRequest(req)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, float64(5), m["appearances"])
+	require.Equal(t, "matched", m["lookupStatus"])
+	require.Equal(t, `"2"`, response.Header().Get("ETag"))
+
+	//the copy read before the refresh is stale
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v", id), nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	clearDatabase()
+}
+
+func TestRefreshNonExistentPlanet(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	url := fmt.Sprintf("/api/planet/%v/refresh", id)
+
+	req, _ := http.NewRequest("POST", url, nil)
+	req.Header.Set("If-Match", "*")
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestGetPlanetWithSwapiAttributes(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Hoth",
+		Terrain: "Tundra",
+		Climate: "Frozen",
+	}
+
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	response := executeRequest(req)
+
+	var m map[string]map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, float64(7200), m["swapi"]["diameter"])
+	require.Contains(t, m["swapi"], "population")
+	require.Nil(t, m["swapi"]["population"])
+
+	clearDatabase()
+}
+
+func TestSearchBySwapiAttributes(t *testing.T) {
+	addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	addMockPlanet(models.Planet{Name: "Alderaan", Terrain: "Grasslands", Climate: "Temperate"})
+
+	req, _ := http.NewRequest("GET", "/api/planets?minDiameter=11000&maxPopulation=3000000000", nil)
+	response := executeRequest(req)
+
+	var m services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Len(t, m.Result, 1)
+	require.Equal(t, "Alderaan", m.Result[0].Name)
+
+	clearDatabase()
+}
+
+func TestSearchWithMalformedSwapiAttributes(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/planets?minDiameter=big", nil)
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/planets?minDiameter=10&maxDiameter=5", nil)
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+}
+
+func TestSearchByClimateTerrainAndAppearances(t *testing.T) {
+	addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	addMockPlanet(models.Planet{Name: "Geonosis", Terrain: "rock, desert, mountain, barren", Climate: "temperate, arid"})
+	addMockPlanet(models.Planet{Name: "Alderaan", Terrain: "grasslands, mountains", Climate: "temperate"})
+
+	req, _ := http.NewRequest("GET", "/api/planets?climate=arid&terrain=desert&minAppearances=2&maxAppearances=5&createdAfter=2021-01-01", nil)
+	response := executeRequest(req)
+
+	var m services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Len(t, m.Result, 1)
+	require.Equal(t, "Tatooine", m.Result[0].Name)
+
+	req, _ = http.NewRequest("GET", "/api/planets?climate=temperate,%20tropical", nil)
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Len(t, m.Result, 2)
+
+	clearDatabase()
+}
+
+func TestSearchWithMalformedFilters(t *testing.T) {
+	urls := []string{
+		"/api/planets?minAppearances=two",
+		"/api/planets?minAppearances=-1",
+		"/api/planets?maxAppearances=1.5",
+		"/api/planets?minAppearances=5&maxAppearances=2",
+		"/api/planets?createdAfter=yesterday",
+		"/api/planets?createdBefore=2021-13-01",
+		"/api/planets?climate=,",
+	}
+
+	for _, url := range urls {
+		req, _ := http.NewRequest("GET", url, nil)
+		response := executeRequest(req)
+
+		require.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+}
+
+func TestSearchWithInvalidNamePattern(t *testing.T) {
+	for _, url := range []string{"/api/planets?name=(", "/api/planets/trash?name=[a-", "/api/planets/export?name=*"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		response := executeRequest(req)
+
+		require.Equal(t, http.StatusBadRequest, response.Code, url)
+
+		var problem controller.Problem
+		json.Unmarshal(response.Body.Bytes(), &problem)
+
+		require.Equal(t, "/problems/validation", problem.Type, url)
+		require.Equal(t, []controller.InvalidParam{{Name: "name", Reason: "must be a valid regular expression"}}, problem.InvalidParams)
+	}
+}
+
+func TestSearchWithSortAndPageSize(t *testing.T) {
+	addMockPlanet(models.Planet{Name: "Hoth", Terrain: "Tundra", Climate: "Frozen"})
+	addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	addMockPlanet(models.Planet{Name: "Alderaan", Terrain: "Grasslands", Climate: "Temperate"})
+
+	req, _ := http.NewRequest("GET", "/api/planets?sort=-appearances,name&perPage=2", nil)
+	response := executeRequest(req)
+
+	var m services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, int64(2), m.PerPage)
+	require.Equal(t, int64(2), m.TotalPage)
+	require.Equal(t, int64(2), m.Next)
+	require.Equal(t, "Tatooine", m.Result[0].Name)
+	require.Equal(t, "Alderaan", m.Result[1].Name)
+
+	req, _ = http.NewRequest("GET", "/api/planets?sort=-appearances,name&perPage=2&page=2", nil)
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Len(t, m.Result, 1)
+	require.Equal(t, "Hoth", m.Result[0].Name)
+
+	clearDatabase()
+}
+
+func TestSearchWithInvalidSortOrPageSize(t *testing.T) {
+	urls := []string{
+		"/api/planets?sort=password",
+		"/api/planets?sort=name,-name",
+		"/api/planets?perPage=0",
+		"/api/planets?perPage=ten",
+	}
+
+	for _, url := range urls {
+		req, _ := http.NewRequest("GET", url, nil)
+		response := executeRequest(req)
+
+		require.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+}
+
+func TestSearchByCursor(t *testing.T) {
+	addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	addMockPlanet(models.Planet{Name: "Hoth", Terrain: "Tundra", Climate: "Frozen"})
+	addMockPlanet(models.Planet{Name: "Tund", Terrain: "Barren", Climate: "Unknown"})
+
+	req, _ := http.NewRequest("GET", "/api/planets?cursor=&perPage=1&name=t", nil)
+	response := executeRequest(req)
+
+	var m services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, []string{"Tatooine"}, []string{m.Result[0].Name})
+	require.NotEmpty(t, m.NextCursor)
+
+	visited := []string{m.Result[0].Name}
+	for m.NextCursor != "" {
+		req, _ = http.NewRequest("GET", "/api/planets?perPage=1&name=t&cursor="+m.NextCursor, nil)
+		response = executeRequest(req)
+
+		m = services.SearchResponse{}
+		json.Unmarshal(response.Body.Bytes(), &m)
+		require.Equal(t, http.StatusOK, response.Code)
+
+		for _, planet := range m.Result {
+			visited = append(visited, planet.Name)
+		}
+	}
+
+	require.Equal(t, []string{"Tatooine", "Hoth", "Tund"}, visited)
+
+	clearDatabase()
+}
+
+func TestSearchWithInvalidCursor(t *testing.T) {
+	urls := []string{
+		"/api/planets?cursor=garbage",
+		"/api/planets?cursor=&page=2",
+		"/api/planets?cursor=&sort=name",
+	}
+
+	for _, url := range urls {
+		req, _ := http.NewRequest("GET", url, nil)
+		response := executeRequest(req)
+
+		require.Equal(t, http.StatusBadRequest, response.Code, url)
+	}
+}
+
+func TestCreateDuplicatePlanet(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+
+	var jsonStr = []byte(`{
+		"name": "TATOOINE",
+		"climate": "arid",
+		"terrain": "desert"
+	}`)
+
+	req, _ := http.NewRequest("POST", "/api/planet", bytes.NewBuffer(jsonStr))
+	req.Header.Set("Content-Type", "application/json")
+
+	response := executeRequest(req)
+
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
+
+	require.Equal(t, http.StatusConflict, response.Code)
+	require.Equal(t, "conflict", problem.Code)
+	require.Equal(t, id, problem.ExistingID)
+
+	clearDatabase()
+}
+
+func TestCreatePlanetNamedAsATrashedOne(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/planet/%v", id), nil)
+	req.Header.Set("If-Match", `"1"`)
+	executeRequest(req)
+
+	req, _ = http.NewRequest("POST", "/api/planet", bytes.NewBufferString(`{"name": "tatooine", "climate": "arid", "terrain": "desert"}`))
+	req.Header.Set("Content-Type", "application/json")
+	response := executeRequest(req)
+
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
+
+	require.Equal(t, http.StatusConflict, response.Code)
+	require.Equal(t, id, problem.ExistingID)
+	require.Contains(t, problem.Detail, "trash")
+	require.Equal(t, fmt.Sprintf("/api/planet/%v/restore", id), problem.Restore)
+
+	//the planet the conflict points to can be restored from there
+	req, _ = http.NewRequest("POST", problem.Restore, nil)
+	req.Header.Set("If-Match", "*")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	clearDatabase()
+}
+
+func TestTrashAndRestorePlanet(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	addMockPlanet(models.Planet{Name: "Hoth", Terrain: "Tundra", Climate: "Frozen"})
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/planet/%v", id), nil)
+	req.Header.Set("If-Match", `"1"`)
+	executeRequest(req)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v", id), nil)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/planets/trash", nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &res)
+
+	require.Equal(t, int64(1), res.Total)
+	require.Equal(t, "Tatooine", res.Result[0].Name)
+	require.NotNil(t, res.Result[0].DeletedAt)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/planet/%v/restore", id), nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusPreconditionRequired, response.Code)
+
+	req.Header.Set("If-Match", `"2"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+
+	require.Equal(t, id, m["_id"])
+	require.NotContains(t, m, "deletedAt")
+
+	req, _ = http.NewRequest("GET", "/api/planets/trash", nil)
+	response = executeRequest(req)
+	json.Unmarshal(response.Body.Bytes(), &res)
+
+	require.Equal(t, int64(0), res.Total)
+
+	clearDatabase()
+}
+
+func TestRestoreNonDeletedPlanet(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/planet/%v/restore", id), nil)
+	req.Header.Set("If-Match", "*")
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusNotFound, response.Code)
+
+	clearDatabase()
+}
+
+func TestPlanetHistoryAndRevert(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/planet/%v", id), bytes.NewBuffer([]byte(`{"name": "Tatooine", "climate": "arid", "terrain": "dunes"}`)))
+	req.Header.Set("If-Match", `"1"`)
+	req.Header.Set("X-Author", "luke")
+	executeRequest(req)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v/history", id), nil)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var history []models.Revision
+	json.Unmarshal(response.Body.Bytes(), &history)
+
+	require.Len(t, history, 2)
+	require.Equal(t, "luke", history[1].Author)
+	require.Equal(t, "dunes", history[1].Planet.Terrain)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v/history/1", id), nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var revision models.Revision
+	json.Unmarshal(response.Body.Bytes(), &revision)
+	require.Equal(t, "desert", revision.Planet.Terrain)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/planet/%v/history/1/revert", id), nil)
+	req.Header.Set("If-Match", `"2"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var m map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &m)
+	require.Equal(t, "desert", m["terrain"])
+
+	clearDatabase()
+}
+
+func TestGetMissingOrMalformedRevision(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/planet/%v/history/7", id), nil)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v/history", primitive.NewObjectID().Hex()), nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusNotFound, response.Code)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/planet/%v/history/last", id), nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/planet/%v/history/7/revert", id), nil)
+	req.Header.Set("If-Match", `"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusNotFound, response.Code)
+
+	clearDatabase()
+}
+
+func TestConditionalRequests(t *testing.T) {
+	id := addMockPlanet(models.Planet{Name: "Tatooine", Terrain: "Desert", Climate: "Arid"})
+	url := fmt.Sprintf("/api/planet/%v", id)
+	update := []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "dunes"}`)
+
+	req, _ := http.NewRequest("GET", url, nil)
+	response := executeRequest(req)
+	require.Equal(t, `"1"`, response.Header().Get("ETag"))
+
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", `W/"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusNotModified, response.Code)
+	require.Empty(t, response.Body.Bytes())
+
+	req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(update))
+	response = executeRequest(req)
+	require.Equal(t, http.StatusPreconditionRequired, response.Code)
+
+	req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(update))
+	req.Header.Set("If-Match", "1")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("PUT", url, bytes.NewBuffer(update))
+	req.Header.Set("If-Match", `"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, `"2"`, response.Header().Get("ETag"))
+
+	//the version read before the update is stale now
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusPreconditionFailed, response.Code)
+
+	req, _ = http.NewRequest("GET", url, nil)
+	req.Header.Set("If-None-Match", `"1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", "*")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	clearDatabase()
+}
+
+func TestIfMatchUsesStrongComparison(t *testing.T) {
+	planet := models.Planet{Name: "Tatooine", Climate: "arid", Terrain: "desert"}
+	id := addMockPlanet(planet)
+	url := fmt.Sprintf("/api/planet/%v", id)
+
+	//weak tags never match, even at the current version
+	req, _ := http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `W/"1"`)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusPreconditionFailed, response.Code)
+
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `"3", "2"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusPreconditionFailed, response.Code)
+
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `"1", *`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("DELETE", url, nil)
+	req.Header.Set("If-Match", `W/"1", "3", "1"`)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusOK, response.Code)
+
+	clearDatabase()
+}
+
+func TestBulkCreatePlanets(t *testing.T) {
+	var jsonStr = []byte(`[
+		{"name": "Tatooine", "climate": "arid", "terrain": "desert"},
+		{"name": "Hoth", "climate": "frozen"}
+	]`)
+
+	req, _ := http.NewRequest("POST", "/api/planets/bulk", bytes.NewBuffer(jsonStr))
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res services.BulkResponse
+	json.Unmarshal(response.Body.Bytes(), &res)
+
+	require.Equal(t, 1, res.Created)
+	require.Equal(t, 1, res.Invalid)
+	require.Equal(t, "Tatooine", res.Results[0].Planet.Name)
+	require.Equal(t, "Missing required field", res.Results[1].Errors["terrain"])
+
+	clearDatabase()
+}
+
+func TestBulkCreateWithInvalidBody(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/api/planets/bulk", bytes.NewBuffer([]byte(`{"name": "Tatooine"}`)))
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/planets/bulk", bytes.NewBuffer([]byte(`[{}] []`)))
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	items := "[" + strings.TrimSuffix(strings.Repeat(`{},`, services.DefaultMaxBulkSize+1), ",") + "]"
+	req, _ = http.NewRequest("POST", "/api/planets/bulk", bytes.NewBuffer([]byte(items)))
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+
+	//the planets past the limit are not even read
+	req, _ = http.NewRequest("POST", "/api/planets/bulk", io.MultiReader(strings.NewReader(items), brokenBody{}))
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+
+	//nor is the rest of a body larger than its planets may be
+	huge := `[{"name": "` + strings.Repeat("a", services.DefaultMaxBulkSize*8<<10) + `"}]`
+	req, _ = http.NewRequest("POST", "/api/planets/bulk", bytes.NewBuffer([]byte(huge)))
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+}
+
+// brokenBody fails to be read, as a body whose client went away
+type brokenBody struct{}
+
+func (brokenBody) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestImportPlanets(t *testing.T) {
+	file := "name,climate,terrain\nTatooine,arid,desert\nHoth,frozen,\n"
+
+	req, _ := http.NewRequest("POST", "/api/planets/import?dryRun=true", strings.NewReader(file))
+	req.Header.Set("Content-Type", "text/csv; charset=utf-8")
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusOK, response.Code)
+
+	var res services.ImportResponse
+	json.Unmarshal(response.Body.Bytes(), &res)
+
+	require.True(t, res.DryRun)
+	require.Equal(t, 1, res.Created)
+	require.Equal(t, 3, res.Errors[0].Row)
+
+	req, _ = http.NewRequest("POST", "/api/planets/import", strings.NewReader(file))
+	req.Header.Set("Content-Type", "text/csv")
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusOK, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/planets?name=tatooine", nil)
+	response = executeRequest(req)
+
+	var search services.SearchResponse
+	json.Unmarshal(response.Body.Bytes(), &search)
+	require.Equal(t, int64(1), search.Total)
+
+	clearDatabase()
+}
+
+func TestImportPlanetsWithInvalidRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/api/planets/import", strings.NewReader(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	response := executeRequest(req)
+	require.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/planets/import?dryRun=maybe", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/planets/import", strings.NewReader("planet\nTatooine\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("POST", "/api/planets/import", strings.NewReader(strings.Repeat("\n", services.DefaultMaxImportSize+1)))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	response = executeRequest(req)
+	require.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+}
+
+func TestExportPlanets(t *testing.T) {
+	addMockPlanet(models.Planet{Name: "Tatooine", Climate: "arid", Terrain: "desert"})
+	addMockPlanet(models.Planet{Name: "Hoth", Climate: "frozen", Terrain: "tundra"})
+
+	req, _ := http.NewRequest("GET", "/api/planets/export?format=csv&climate=arid", nil)
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "text/csv; charset=utf-8", response.Header().Get("Content-Type"))
+	require.Equal(t, "attachment; filename=planets.csv", response.Header().Get("Content-Disposition"))
+
+	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], "Tatooine")
+
+	req, _ = http.NewRequest("GET", "/api/planets/export?sort=-name", nil)
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusOK, response.Code)
+	require.Equal(t, "application/json", response.Header().Get("Content-Type"))
+
+	var planets []models.Planet
+	json.Unmarshal(response.Body.Bytes(), &planets)
+	require.Len(t, planets, 2)
+	require.Equal(t, "Tatooine", planets[0].Name)
+
+	clearDatabase()
+}
+
+func TestExportPlanetsWithInvalidParams(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/planets/export?format=xml", nil)
+	response := executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	req, _ = http.NewRequest("GET", "/api/planets/export?format=ndjson&minAppearances=many", nil)
+	response = executeRequest(req)
+	require.Equal(t, http.StatusBadRequest, response.Code)
+	require.Empty(t, response.Header().Get("Content-Disposition"))
+}
+
+func TestInvalidIDProblem(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/planet/tatooine", nil)
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
+
+	require.Equal(t, "invalid-id", problem.Code)
+	require.NotContains(t, problem.Detail, "hex string")
+}
+
+func TestCreatePlanetWithUnknownOrInvalidFields(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/api/planet", strings.NewReader(`{"name": "Hoth", "climate": "frozen", "terrain": "tundra", "moons": 3}`))
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	var problem controller.Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
+	require.Equal(t, []controller.InvalidParam{{Name: "moons", Reason: "is not a field of a planet"}}, problem.InvalidParams)
+
+	req, _ = http.NewRequest("POST", "/api/planet", strings.NewReader(`{"name": " ", "climate": "frozen!", "terrain": "tundra"}`))
+	response = executeRequest(req)
+
+	require.Equal(t, http.StatusBadRequest, response.Code)
+
+	problem = controller.Problem{}
+	json.Unmarshal(response.Body.Bytes(), &problem)
+	require.Len(t, problem.InvalidParams, 2)
+	require.Equal(t, "climate", problem.InvalidParams[0].Name)
+	require.Equal(t, "name", problem.InvalidParams[1].Name)
+}
+
+func TestCreatePlanetNormalizesFields(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/api/planet", strings.NewReader(`{"name": "  Hoth ", "climate": "Frozen", "terrain": "Tundra,Ice Caves"}`))
+	response := executeRequest(req)
+
+	require.Equal(t, http.StatusCreated, response.Code)
+
+	var planet models.Planet
+	json.Unmarshal(response.Body.Bytes(), &planet)
+	require.Equal(t, "Hoth", planet.Name)
+	require.Equal(t, "frozen", planet.Climate)
+	require.Equal(t, "tundra, ice caves", planet.Terrain)
+
+	clearDatabase()
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/utils"
+)
+
+// The codes of the problems sent by the API. The type of a problem is its
+// code under /problems/.
+const (
+	problemBadRequest           = "bad-request"
+	problemInvalidID            = "invalid-id"
+	problemValidation           = "validation"
+	problemNotFound             = "not-found"
+	problemConflict             = "conflict"
+	problemVersionMismatch      = "version-mismatch"
+	problemPreconditionRequired = "precondition-required"
+	problemTooLarge             = "too-large"
+	problemUnsupportedMediaType = "unsupported-media-type"
+	problemUpstream             = "upstream-unavailable"
+	problemTimeout              = "timeout"
+	problemInternal             = "internal"
+)
+
+var problemTitles = map[string]string{
+	problemBadRequest:           "The request is malformed",
+	problemInvalidID:            "The planet id is not valid",
+	problemValidation:           "The planet is not valid",
+	problemNotFound:             "Not found",
+	problemConflict:             "A planet with this name already exists",
+	problemVersionMismatch:      "The planet was changed since this version",
+	problemPreconditionRequired: "If-Match header is required",
+	problemTooLarge:             "The request is too large",
+	problemUnsupportedMediaType: "Unsupported Content-Type",
+	problemUpstream:             "A service the API depends on is unavailable",
+	problemTimeout:              "The request took too long",
+	problemInternal:             "Internal server error",
+}
+
+// Problem is an error response as described by RFC 7807, with the code of
+// the problem and, depending on it, the invalid fields of the planet or the
+// planet that already has its name, along with where to restore it when it
+// is in the trash. Created tells how many planets an import that stopped
+// halfway had already created.
+type Problem struct {
+	Type          string         `json:"type"`
+	Code          string         `json:"code"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	Instance      string         `json:"instance,omitempty"`
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+	ExistingID    string         `json:"existingId,omitempty"`
+	Restore       string         `json:"restore,omitempty"`
+	Created       int            `json:"created,omitempty"`
+}
+
+// InvalidParam is a field that failed validation
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func newProblem(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "/problems/" + code,
+		Code:   code,
+		Title:  problemTitles[code],
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// problemOf maps an error of the services, or of the request itself, to the
+// problem sent to the client. Errors it does not know are only logged, so no
+// internal message reaches the client.
+func problemOf(err error) Problem {
+	var (
+		notFound   *services.ErrNotFound
+		invalidID  *services.ErrInvalidID
+		validation *services.ErrValidation
+		conflict   *services.ErrConflict
+		tooLarge   *services.ErrBulkTooLarge
+		fileSize   *services.ErrImportTooLarge
+		incomplete *services.ErrImportIncomplete
+		upstream   *services.ErrUpstream
+	)
+
+	switch {
+	case errors.As(err, &incomplete):
+		problem := problemOf(incomplete.Err)
+		problem.Created = incomplete.Created
+		return problem
+	case errors.As(err, &notFound):
+		return newProblem(http.StatusNotFound, problemNotFound, err.Error())
+	case errors.As(err, &invalidID):
+		return newProblem(http.StatusBadRequest, problemInvalidID, err.Error())
+	case errors.As(err, &validation):
+		problem := newProblem(http.StatusBadRequest, problemValidation, err.Error())
+		problem.InvalidParams = invalidParams(validation.Fields)
+		return problem
+	case errors.As(err, &conflict):
+		problem := newProblem(http.StatusConflict, problemConflict, err.Error())
+		problem.ExistingID = conflict.ExistingID
+		if conflict.Trashed && conflict.ExistingID != "" {
+			problem.Restore = "/api/planet/" + conflict.ExistingID + "/restore"
+		}
+		return problem
+	case errors.Is(err, services.ErrVersionMismatch):
+		return newProblem(http.StatusPreconditionFailed, problemVersionMismatch, err.Error())
+	case errors.Is(err, errPreconditionRequired):
+		return newProblem(http.StatusPreconditionRequired, problemPreconditionRequired, err.Error())
+	case errors.Is(err, errMalformedIfMatch), errors.Is(err, services.ErrInvalidImport), errors.Is(err, services.ErrInvalidExport):
+		return newProblem(http.StatusBadRequest, problemBadRequest, err.Error())
+	case errors.As(err, &tooLarge), errors.As(err, &fileSize):
+		return newProblem(http.StatusRequestEntityTooLarge, problemTooLarge, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return newProblem(http.StatusGatewayTimeout, problemTimeout, "the request took too long, try again later")
+	case errors.As(err, &upstream):
+		log.Printf("upstream error: %v", err)
+		return newProblem(http.StatusServiceUnavailable, problemUpstream, "the "+upstream.Service+" is unavailable, try again later")
+	}
+
+	log.Printf("internal error: %v", err)
+	return newProblem(http.StatusInternalServerError, problemInternal, "something went wrong on our side")
+}
+
+// invalidParams lists the invalid fields sorted by name
+func invalidParams(fields map[string]string) []InvalidParam {
+	params := []InvalidParam{}
+	for name, reason := range fields {
+		params = append(params, InvalidParam{Name: name, Reason: reason})
+	}
+
+	sort.Slice(params, func(i, j int) bool {
+		return params[i].Name < params[j].Name
+	})
+
+	return params
+}
+
+// respondWithError sends err as a problem about the request
+func respondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	respondWithProblem(w, r, problemOf(err))
+}
+
+// respondWithBadRequest sends a problem about a malformed request
+func respondWithBadRequest(w http.ResponseWriter, r *http.Request, detail string) {
+	respondWithProblem(w, r, newProblem(http.StatusBadRequest, problemBadRequest, detail))
+}
+
+// respondWithQueryError sends a validation problem when err has the invalid
+// params of the query string, or a problem about a malformed request otherwise
+func respondWithQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	var validation *services.ErrValidation
+	if errors.As(err, &validation) {
+		respondWithError(w, r, err)
+		return
+	}
+
+	respondWithBadRequest(w, r, err.Error())
+}
+
+func respondWithProblem(w http.ResponseWriter, r *http.Request, problem Problem) {
+	problem.Instance = r.URL.Path
+	utils.RespondWithProblem(w, problem.Status, problem)
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+)
+
+// parseSearchFilter reads the search criteria from the query string, e.g.
+// name=tat&climate=arid,temperate&minAppearances=2&createdAfter=2021-05-01&minPopulation=1000
+func parseSearchFilter(query url.Values) (services.SearchFilter, error) {
+	var err error
+	filter := services.SearchFilter{
+		Name:  query.Get("name"),
+		Swapi: map[string]services.Range{},
+	}
+
+	//the name is a regular expression, checked here so a bad one is not sent
+	//to the database
+	if _, err = regexp.Compile(filter.Name); err != nil {
+		return filter, &services.ErrValidation{Fields: map[string]string{"name": "must be a valid regular expression"}}
+	}
+
+	filter.Climates, err = parseListParam(query, "climate")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Terrains, err = parseListParam(query, "terrain")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Appearances, err = parseRange(query, "Appearances")
+	if err != nil {
+		return filter, err
+	}
+
+	if (filter.Appearances.Min != nil && !isNonNegativeInteger(*filter.Appearances.Min)) ||
+		(filter.Appearances.Max != nil && !isNonNegativeInteger(*filter.Appearances.Max)) {
+		return filter, errors.New("minAppearances and maxAppearances must be non negative integers")
+	}
+
+	filter.CreatedAfter, err = parseTimeParam(query, "createdAfter")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.CreatedBefore, err = parseTimeParam(query, "createdBefore")
+	if err != nil {
+		return filter, err
+	}
+
+	for _, field := range services.SwapiNumericFields {
+		r, err := parseRange(query, strings.ToUpper(field[:1])+field[1:])
+		if err != nil {
+			return filter, err
+		}
+
+		filter.Swapi[field] = r
+	}
+
+	return filter, nil
+}
+
+// parseRange reads the min<suffix> and max<suffix> params
+func parseRange(query url.Values, suffix string) (services.Range, error) {
+	r := services.Range{}
+	var err error
+
+	r.Min, err = parseFloatParam(query, "min"+suffix)
+	if err != nil {
+		return r, err
+	}
+
+	r.Max, err = parseFloatParam(query, "max"+suffix)
+	if err != nil {
+		return r, err
+	}
+
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return r, fmt.Errorf("min%v must not be greater than max%v", suffix, suffix)
+	}
+
+	return r, nil
+}
+
+func parseFloatParam(query url.Values, param string) (*float64, error) {
+	value := query.Get(param)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%v must be a number", param)
+	}
+
+	return &number, nil
+}
+
+// parseListParam reads comma separated values, the param may also be repeated
+func parseListParam(query url.Values, param string) ([]string, error) {
+	items := []string{}
+
+	for _, value := range query[param] {
+		values := models.SplitList(value)
+		if len(values) == 0 {
+			return nil, fmt.Errorf("%v must not be empty", param)
+		}
+
+		items = append(items, values...)
+	}
+
+	return items, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain dates
+func parseTimeParam(query url.Values, param string) (*time.Time, error) {
+	value := query.Get(param)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return &t, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%v must be a RFC 3339 timestamp or a date like 2006-01-02", param)
+}
+
+func isNonNegativeInteger(value float64) bool {
+	return value >= 0 && value == math.Trunc(value)
+}
+
+// parsePagination reads the perPage and sort params, sort being a comma
+// separated list of fields prefixed by - for descending order, e.g.
+// sort=name,-appearances. The page param is left to the caller.
+func parsePagination(query url.Values) (services.Pagination, error) {
+	pagination := services.Pagination{}
+
+	if perPage := query.Get("perPage"); perPage != "" {
+		value, err := strconv.ParseInt(perPage, 10, 64)
+		if err != nil || value < 1 {
+			return pagination, errors.New("perPage must be a positive integer")
+		}
+
+		pagination.PerPage = value
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		seen := map[string]bool{}
+
+		for _, key := range strings.Split(sort, ",") {
+			field := services.SortField{Field: strings.TrimSpace(key)}
+
+			if strings.HasPrefix(field.Field, "-") {
+				field.Field = field.Field[1:]
+				field.Descending = true
+			}
+
+			if !services.IsSortable(field.Field) {
+				return pagination, fmt.Errorf("cannot sort by %q, sortable fields are %v", field.Field, strings.Join(services.SortableFields, ", "))
+			}
+
+			if seen[field.Field] {
+				return pagination, fmt.Errorf("cannot sort by %q more than once", field.Field)
+			}
+			seen[field.Field] = true
+
+			pagination.Sort = append(pagination.Sort, field)
+		}
+	}
+
+	return pagination, nil
+}
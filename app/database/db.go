@@ -2,16 +2,36 @@ package database
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"log"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func dbInstance() (*mongo.Client, error) {
-	mongoURI := os.Getenv("MONGODB_URL")
-	client, err := mongo.NewClient(options.Client().ApplyURI(mongoURI))
+// Settings tell how to connect to a database, zero pool sizes keeping the
+// defaults of the driver
+type Settings struct {
+	URL         string
+	Database    string
+	MinPoolSize uint64
+	MaxPoolSize uint64
+}
+
+func dbInstance(settings Settings) (*mongo.Client, error) {
+	clientOptions := options.Client().ApplyURI(settings.URL)
+	if settings.MinPoolSize > 0 {
+		clientOptions.SetMinPoolSize(settings.MinPoolSize)
+	}
+
+	if settings.MaxPoolSize > 0 {
+		clientOptions.SetMaxPoolSize(settings.MaxPoolSize)
+	}
+
+	client, err := mongo.NewClient(clientOptions)
 	if err != nil {
 		return nil, err
 	}
@@ -26,15 +46,71 @@ func dbInstance() (*mongo.Client, error) {
 	return client, nil
 }
 
-func Connect(database string) (*mongo.Database, error) {
-	client, err := dbInstance()
+// Connect opens the database named on the settings
+func Connect(settings Settings) (*mongo.Database, error) {
+	client, err := dbInstance(settings)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.Database(database), nil
+	return client.Database(settings.Database), nil
+}
+
+// ErrUnreachable is returned by Ping when the database never answered
+var ErrUnreachable = errors.New("mongo is unreachable")
+
+const (
+	// pingTimeout bounds each attempt of Ping
+	pingTimeout = 2 * time.Second
+	// pingBackoff is the wait after the first failed attempt of Ping,
+	// doubled after each of the others up to maxPingBackoff
+	pingBackoff    = 250 * time.Millisecond
+	maxPingBackoff = 5 * time.Second
+)
+
+// Ping checks that the database is reachable, which Connect does not as the
+// driver connects lazily. Failed attempts are tried again with an exponential
+// backoff for up to maxWait, or until ctx is done when maxWait is zero.
+func Ping(ctx context.Context, database *mongo.Database, maxWait time.Duration) error {
+	if maxWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, maxWait)
+		defer cancel()
+	}
+
+	backoff := pingBackoff
+	for {
+		attempt, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := database.Client().Ping(attempt, readpref.Primary())
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", ErrUnreachable, err)
+		}
+
+		log.Printf("mongo is not reachable yet, trying again in %v: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %v", ErrUnreachable, err)
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxPingBackoff {
+			backoff = maxPingBackoff
+		}
+	}
 }
 
+// CaseInsensitive compares strings ignoring case, it must be used by queries
+// that rely on the unique index over the planet names
+var CaseInsensitive = &options.Collation{Locale: "en", Strength: 2}
+
 func GetCollection(database *mongo.Database, collectionName string) *mongo.Collection {
 	return database.Collection(collectionName)
 }
@@ -1,42 +1,40 @@
 package database_test
 
 import (
-	"os"
+	"context"
 	"testing"
+	"time"
 
+	"github.com/Azuos0/b2w_challenge/app/config/configtest"
 	"github.com/Azuos0/b2w_challenge/app/database"
-	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
 )
 
-func getDbName() string {
-	dbName := os.Getenv("MONGODB_TEST_DATABASE")
-
-	//load env variables if they are not loaded yet,
-	if dbName == "" {
-		godotenv.Load("../../.env")
-		_ = os.Getenv("MONGODB_TEST_DATABASE")
-		dbName = os.Getenv("MONGODB_TEST_DATABASE")
-	}
-
-	return dbName
-}
-
 func TestDbConnect(t *testing.T) {
-	dbName := getDbName()
-	db, err := database.Connect(dbName)
+	db, err := database.Connect(configtest.Mongo())
 
 	require.NotNil(t, db)
 	require.Nil(t, err)
 }
 
 func TestDbGetCollection(t *testing.T) {
-	dbName := getDbName()
 	collectionName := "planets"
 
-	db, _ := database.Connect(dbName)
+	db, _ := database.Connect(configtest.Mongo())
 
 	collection := database.GetCollection(db, collectionName)
 
 	require.NotNil(t, collection)
 }
+
+func TestPingUnreachable(t *testing.T) {
+	//nothing listens on port 1
+	db, err := database.Connect(database.Settings{URL: "mongodb://127.0.0.1:1", Database: "swapp_test"})
+	require.Nil(t, err)
+
+	start := time.Now()
+	err = database.Ping(context.Background(), db, 500*time.Millisecond)
+
+	require.ErrorIs(t, err, database.ErrUnreachable)
+	require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+}
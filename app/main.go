@@ -1,27 +1,59 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Azuos0/b2w_challenge/app/config"
 	"github.com/Azuos0/b2w_challenge/app/server"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	app := server.App{}
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML file with the configuration")
+	printConfig := flag.Bool("print-config", false, "print the configuration, with secrets redacted, and exit")
+	flag.Parse()
 
-	if os.Getenv("PORT") == "" {
-		err := godotenv.Load(".env")
+	settings, err := config.Load(config.Options{File: *configFile, EnvFile: ".env"})
 
+	if *printConfig {
+		settings.Print(os.Stdout)
 		if err != nil {
-			log.Fatalf("Error loading .env file")
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	uri := os.Getenv("MONGODB_DATABASE")
-	app.InitializeApp(uri)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "migrate" {
+		runMigrations(settings, args[1:])
+		return
+	}
+
+	app := server.App{Config: settings}
+
+	if settings.Storage == config.StorageMemory {
+		app.InitializeInMemoryApp()
+	} else if err := app.InitializeApp(); err != nil {
+		log.Fatal(err)
+	}
+
+	//deploys stop the app with SIGTERM, a terminal with SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
 
-	port := os.Getenv("PORT")
-	app.Run(port)
+	log.Println("Server stopped")
 }
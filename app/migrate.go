@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/config"
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/migrations"
+	"github.com/Azuos0/b2w_challenge/app/server"
+)
+
+const migrateUsage = `usage: migrate <up|down|status> [flags]
+
+  up      applies every pending migration
+  down    reverts the last applied migrations
+  status  lists the migrations and whether they were applied
+`
+
+// runMigrations handles the migrate subcommand, e.g. "migrate down -steps 2 -dry-run"
+func runMigrations(settings config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	command := args[0]
+	flags := flag.NewFlagSet("migrate "+command, flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "only print what would be done")
+	steps := flags.Int("steps", 1, "number of migrations to revert with down")
+	flags.Parse(args[1:])
+
+	db, err := database.Connect(server.MongoSettings(settings.Mongo))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	if err := database.Ping(ctx, db, settings.Mongo.ConnectTimeout); err != nil {
+		log.Fatal(err)
+	}
+
+	runner := migrations.NewRunner(db, migrations.All)
+	runner.DryRun = *dryRun
+
+	switch command {
+	case "up":
+		done, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%v migrations applied", len(done))
+	case "down":
+		done, err := runner.Down(ctx, *steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("%v migrations reverted", len(done))
+	case "status":
+		applied, err := runner.Applied(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, migration := range runner.Migrations {
+			state := "pending"
+			if record, ok := applied[migration.Version]; ok {
+				state = "applied at " + record.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%3v  %-70v %v\n", migration.Version, migration.Description, state)
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,175 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All are the application migrations. New migrations must be appended with
+// the next version, applied ones must never be changed.
+var All = []Migration{
+	{
+		Version:     1,
+		Description: "unique case insensitive index on planet names",
+		Up: uniqueNames(createIndex("planets", mongo.IndexModel{
+			Keys:    bson.D{{Key: "name", Value: 1}},
+			Options: options.Index().SetName("name_unique").SetUnique(true).SetCollation(database.CaseInsensitive),
+		})),
+		Down: dropIndex("planets", "name_unique"),
+	},
+	{
+		Version:     2,
+		Description: "backfill planets createdAt from their ObjectID",
+		Up:          backfillCreatedAt,
+	},
+	{
+		Version:     3,
+		Description: "index planets by createdAt and _id for cursor pagination",
+		Up: createIndex("planets", mongo.IndexModel{
+			Keys:    bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}},
+			Options: options.Index().SetName("createdAt_id"),
+		}),
+		Down: dropIndex("planets", "createdAt_id"),
+	},
+	{
+		Version:     4,
+		Description: "index planets by appearances for range filters and sorting",
+		Up: createIndex("planets", mongo.IndexModel{
+			Keys:    bson.D{{Key: "appearances", Value: 1}},
+			Options: options.Index().SetName("appearances"),
+		}),
+		Down: dropIndex("planets", "appearances"),
+	},
+	{
+		Version:     5,
+		Description: "index planets by appearancesUpdatedAt for the appearances refresher",
+		Up: createIndex("planets", mongo.IndexModel{
+			Keys:    bson.D{{Key: "appearancesUpdatedAt", Value: 1}},
+			Options: options.Index().SetName("appearancesUpdatedAt"),
+		}),
+		Down: dropIndex("planets", "appearancesUpdatedAt"),
+	},
+	{
+		Version:     6,
+		Description: "expire swapi_cache entries",
+		Up: createIndex("swapi_cache", mongo.IndexModel{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+		}),
+		Down: dropIndex("swapi_cache", "expiresAt_ttl"),
+	},
+	{
+		Version:     7,
+		Description: "index planets by deletedAt for the trash and its purge",
+		Up: createIndex("planets", mongo.IndexModel{
+			Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+			Options: options.Index().SetName("deletedAt"),
+		}),
+		Down: dropIndex("planets", "deletedAt"),
+	},
+	{
+		Version:     8,
+		Description: "unique index on planet_revisions numbers",
+		Up: createIndex("planet_revisions", mongo.IndexModel{
+			Keys:    bson.D{{Key: "planetId", Value: 1}, {Key: "revision", Value: 1}},
+			Options: options.Index().SetName("planetId_revision").SetUnique(true),
+		}),
+		Down: dropIndex("planet_revisions", "planetId_revision"),
+	},
+	{
+		Version:     9,
+		Description: "start planets stored without a version at version 1",
+		Up:          backfillVersion,
+	},
+}
+
+func createIndex(collection string, index mongo.IndexModel) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := database.GetCollection(db, collection).Indexes().CreateOne(ctx, index)
+		return err
+	}
+}
+
+func dropIndex(collection string, name string) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		_, err := database.GetCollection(db, collection).Indexes().DropOne(ctx, name)
+		return err
+	}
+}
+
+// uniqueNames runs up only when no two planets, trashed ones included, have
+// the same case insensitive name, otherwise listing the duplicate names so
+// they can be renamed or removed instead of failing on a bare duplicate key
+func uniqueNames(up func(ctx context.Context, db *mongo.Database) error) func(ctx context.Context, db *mongo.Database) error {
+	return func(ctx context.Context, db *mongo.Database) error {
+		pipeline := mongo.Pipeline{
+			{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: "$name"},
+				{Key: "names", Value: bson.D{{Key: "$push", Value: "$name"}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			{{Key: "$match", Value: bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+			{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}
+
+		opts := options.Aggregate().SetCollation(database.CaseInsensitive)
+		cursor, err := database.GetCollection(db, "planets").Aggregate(ctx, pipeline, opts)
+		if err != nil {
+			return err
+		}
+
+		duplicates := []struct {
+			Names []string `bson:"names"`
+		}{}
+		err = cursor.All(ctx, &duplicates)
+		if err != nil {
+			return err
+		}
+
+		if len(duplicates) > 0 {
+			names := make([]string, 0, len(duplicates))
+			for _, duplicate := range duplicates {
+				names = append(names, strings.Join(duplicate.Names, " = "))
+			}
+
+			return fmt.Errorf("planet names must be unique, rename or remove the duplicates first: %v", strings.Join(names, ", "))
+		}
+
+		return up(ctx, db)
+	}
+}
+
+// backfillCreatedAt sets createdAt on planets inserted before it existed, or
+// stored with a zero date, using the creation time embedded on their ObjectID
+func backfillCreatedAt(ctx context.Context, db *mongo.Database) error {
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{{Key: "createdAt", Value: bson.D{{Key: "$toDate", Value: "$_id"}}}}}},
+	}
+
+	filter := bson.M{"$or": []bson.M{
+		{"createdAt": bson.M{"$exists": false}},
+		{"createdAt": nil},
+		{"createdAt": time.Time{}},
+	}}
+
+	_, err := database.GetCollection(db, "planets").UpdateMany(ctx, filter, update)
+
+	return err
+}
+
+// backfillVersion sets the first version on planets stored before versions
+// existed, as writes only match the version the planet is at
+func backfillVersion(ctx context.Context, db *mongo.Database) error {
+	filter := bson.M{"version": bson.M{"$exists": false}}
+
+	_, err := database.GetCollection(db, "planets").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"version": 1}})
+
+	return err
+}
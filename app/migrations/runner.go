@@ -0,0 +1,185 @@
+// Package migrations keeps the MongoDB schema, mostly indexes and backfills,
+// in sync with the code through ordered and versioned migrations
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration changes the database from Version-1 to Version. Down may be nil
+// when there is nothing to undo.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+	Down        func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is the document stored on the migrations collection for every
+// applied migration
+type Record struct {
+	Version     int       `bson:"_id" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+// Runner applies and reverts migrations, registering them on the migrations
+// collection. On DryRun it only reports what would be done.
+type Runner struct {
+	DB         *mongo.Database
+	Migrations []Migration
+	DryRun     bool
+}
+
+func NewRunner(db *mongo.Database, migrations []Migration) *Runner {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Runner{
+		DB:         db,
+		Migrations: sorted,
+	}
+}
+
+// Applied returns the applied migrations by version
+func (runner *Runner) Applied(ctx context.Context) (map[int]Record, error) {
+	records := []Record{}
+
+	cursor, err := runner.collection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Record{}
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+
+	return applied, nil
+}
+
+// Up applies every pending migration in version order, returning the ones it
+// applied, or would apply on DryRun
+func (runner *Runner) Up(ctx context.Context) ([]Migration, error) {
+	err := runner.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := runner.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range runner.Migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		if runner.DryRun {
+			log.Printf("migrations: would apply %v - %v", migration.Version, migration.Description)
+			done = append(done, migration)
+			continue
+		}
+
+		log.Printf("migrations: applying %v - %v", migration.Version, migration.Description)
+
+		err = migration.Up(ctx, runner.DB)
+		if err != nil {
+			return done, fmt.Errorf("migration %v failed: %w", migration.Version, err)
+		}
+
+		_, err = runner.collection().InsertOne(ctx, Record{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now(),
+		})
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, returning the
+// ones it reverted, or would revert on DryRun
+func (runner *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	err := runner.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := runner.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for i := len(runner.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := runner.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		if runner.DryRun {
+			log.Printf("migrations: would revert %v - %v", migration.Version, migration.Description)
+			done = append(done, migration)
+			continue
+		}
+
+		log.Printf("migrations: reverting %v - %v", migration.Version, migration.Description)
+
+		if migration.Down != nil {
+			err = migration.Down(ctx, runner.DB)
+			if err != nil {
+				return done, fmt.Errorf("reverting migration %v failed: %w", migration.Version, err)
+			}
+		}
+
+		_, err = runner.collection().DeleteOne(ctx, bson.M{"_id": migration.Version})
+		if err != nil {
+			return done, err
+		}
+
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func (runner *Runner) validate() error {
+	for i, migration := range runner.Migrations {
+		if migration.Version < 1 || migration.Up == nil {
+			return fmt.Errorf("migration %v must have a positive version and an Up function", migration.Version)
+		}
+
+		if i > 0 && runner.Migrations[i-1].Version == migration.Version {
+			return fmt.Errorf("migration version %v is duplicated", migration.Version)
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) collection() *mongo.Collection {
+	return database.GetCollection(runner.DB, "migrations")
+}
@@ -0,0 +1,155 @@
+package migrations_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/config/configtest"
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/migrations"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func loadDatabase(t *testing.T) *mongo.Database {
+	db, _ := database.Connect(configtest.Mongo())
+	if db == nil {
+		t.Skip("no MongoDB configured")
+	}
+
+	return db
+}
+
+func clearMigrations(db *mongo.Database) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	database.GetCollection(db, "migrations").Drop(ctx)
+}
+
+func countingMigration(version int, ups *[]int, downs *[]int) migrations.Migration {
+	return migrations.Migration{
+		Version:     version,
+		Description: "counting migration",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			*ups = append(*ups, version)
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			*downs = append(*downs, version)
+			return nil
+		},
+	}
+}
+
+func TestNewRunnerSortsMigrations(t *testing.T) {
+	var ups, downs []int
+	runner := migrations.NewRunner(nil, []migrations.Migration{
+		countingMigration(3, &ups, &downs),
+		countingMigration(1, &ups, &downs),
+		countingMigration(2, &ups, &downs),
+	})
+
+	require.Equal(t, 1, runner.Migrations[0].Version)
+	require.Equal(t, 2, runner.Migrations[1].Version)
+	require.Equal(t, 3, runner.Migrations[2].Version)
+}
+
+func TestRunnerRejectsDuplicateVersions(t *testing.T) {
+	var ups, downs []int
+	runner := migrations.NewRunner(nil, []migrations.Migration{
+		countingMigration(1, &ups, &downs),
+		countingMigration(1, &ups, &downs),
+	})
+
+	_, err := runner.Up(context.Background())
+
+	require.Error(t, err)
+	require.Empty(t, ups)
+}
+
+func TestAllMigrationsAreValid(t *testing.T) {
+	for i, migration := range migrations.All {
+		require.Equal(t, i+1, migration.Version)
+		require.NotEmpty(t, migration.Description)
+		require.NotNil(t, migration.Up)
+	}
+}
+
+func TestRunnerUpAndDown(t *testing.T) {
+	db := loadDatabase(t)
+	clearMigrations(db)
+	defer clearMigrations(db)
+
+	var ups, downs []int
+	runner := migrations.NewRunner(db, []migrations.Migration{
+		countingMigration(1, &ups, &downs),
+		countingMigration(2, &ups, &downs),
+	})
+
+	done, err := runner.Up(context.Background())
+	require.Nil(t, err)
+	require.Len(t, done, 2)
+	require.Equal(t, []int{1, 2}, ups)
+
+	//applied migrations are not run again
+	done, err = runner.Up(context.Background())
+	require.Nil(t, err)
+	require.Empty(t, done)
+
+	done, err = runner.Down(context.Background(), 1)
+	require.Nil(t, err)
+	require.Len(t, done, 1)
+	require.Equal(t, []int{2}, downs)
+
+	applied, err := runner.Applied(context.Background())
+	require.Nil(t, err)
+	require.Contains(t, applied, 1)
+	require.NotContains(t, applied, 2)
+}
+
+func TestRunnerDryRun(t *testing.T) {
+	db := loadDatabase(t)
+	clearMigrations(db)
+	defer clearMigrations(db)
+
+	var ups, downs []int
+	runner := migrations.NewRunner(db, []migrations.Migration{countingMigration(1, &ups, &downs)})
+	runner.DryRun = true
+
+	done, err := runner.Up(context.Background())
+	require.Nil(t, err)
+	require.Len(t, done, 1)
+	require.Empty(t, ups)
+
+	applied, err := runner.Applied(context.Background())
+	require.Nil(t, err)
+	require.Empty(t, applied)
+}
+
+func TestUniqueNamesReportsDuplicates(t *testing.T) {
+	//a database of its own, so the index is not left on the test planets
+	db := loadDatabase(t).Client().Database("migrations_duplicates_test")
+	defer db.Drop(context.Background())
+
+	planets := database.GetCollection(db, "planets")
+	_, err := planets.InsertMany(context.Background(), []interface{}{
+		bson.M{"name": "Hoth"},
+		bson.M{"name": "hoth"},
+		bson.M{"name": "Tatooine"},
+	})
+	require.Nil(t, err)
+
+	err = migrations.All[0].Up(context.Background(), db)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Hoth = hoth")
+	require.NotContains(t, err.Error(), "Tatooine")
+
+	_, err = planets.DeleteOne(context.Background(), bson.M{"name": "hoth"})
+	require.Nil(t, err)
+
+	err = migrations.All[0].Up(context.Background(), db)
+	require.Nil(t, err)
+}
@@ -1,6 +1,13 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/asaskevich/govalidator"
@@ -8,23 +15,131 @@ import (
 )
 
 type Planet struct {
-	ID          primitive.ObjectID `json:"_id" valid:"-" bson:"_id, omitempty"`
-	Name        string             `bson:"name, omitempty" valid:"notnull" json:"name"`
-	Climate     string             `bson:"climate, omitempty" valid:"notnull" json:"climate"`
-	Terrain     string             `bson:"terrain, omitempty" valid:"notnull" json:"terrain"`
-	Appearances int                `bson:"appearances, omitempty" valid:"-" json:"appearances"`
-	CreatedAt   time.Time          `bson:"createdAt, omitempty" valid:"-" json:"createdAt"`
+	ID                   primitive.ObjectID `json:"_id" valid:"-" bson:"_id, omitempty"`
+	Name                 string             `bson:"name, omitempty" valid:"notnull,runelength(1|100)~must have at most 100 characters,planetname~may only have letters and numbers with spaces and the characters - ' ." json:"name"`
+	Climate              string             `bson:"climate, omitempty" valid:"notnull,runelength(1|200)~must have at most 200 characters,planetlist~must be a comma separated list of letters and numbers with spaces and the characters - '" json:"climate"`
+	Terrain              string             `bson:"terrain, omitempty" valid:"notnull,runelength(1|200)~must have at most 200 characters,planetlist~must be a comma separated list of letters and numbers with spaces and the characters - '" json:"terrain"`
+	Appearances          int                `bson:"appearances, omitempty" valid:"-" json:"appearances"`
+	AppearancesUpdatedAt time.Time          `bson:"appearancesUpdatedAt" valid:"-" json:"appearancesUpdatedAt"`
+	LookupStatus         string             `bson:"lookupStatus" valid:"-" json:"lookupStatus"`
+	Swapi                *SwapiAttributes   `bson:"swapi" valid:"-" json:"swapi"`
+	CreatedAt            time.Time          `bson:"createdAt, omitempty" valid:"-" json:"createdAt"`
+	// Version is increased on every write, and sent as the ETag of the planet
+	Version int64 `bson:"version" valid:"-" json:"version"`
+	// DeletedAt is set while the planet is in the trash
+	DeletedAt *time.Time `bson:"deletedAt" valid:"-" json:"deletedAt,omitempty"`
 }
 
+// SwapiAttributes are the planet attributes known by swapi. Values swapi
+// reports as "unknown" are kept as null.
+type SwapiAttributes struct {
+	Name           string   `bson:"name" json:"name"`
+	RotationPeriod *int64   `bson:"rotationPeriod" json:"rotationPeriod"`
+	OrbitalPeriod  *int64   `bson:"orbitalPeriod" json:"orbitalPeriod"`
+	Diameter       *int64   `bson:"diameter" json:"diameter"`
+	Gravity        *string  `bson:"gravity" json:"gravity"`
+	SurfaceWater   *float64 `bson:"surfaceWater" json:"surfaceWater"`
+	Population     *int64   `bson:"population" json:"population"`
+	Residents      []string `bson:"residents" json:"residents"`
+	Films          []string `bson:"films" json:"films"`
+}
+
+var (
+	planetName     = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} '.-]*$`)
+	planetListItem = regexp.MustCompile(`^[\p{L}\p{N}][\p{L}\p{N} '-]*$`)
+	unknownField   = regexp.MustCompile(`^json: unknown field "(.*)"$`)
+)
+
 func init() {
 	govalidator.SetFieldsRequiredByDefault(true)
+
+	govalidator.TagMap["planetname"] = govalidator.Validator(planetName.MatchString)
+	govalidator.TagMap["planetlist"] = govalidator.Validator(func(value string) bool {
+		for _, item := range strings.Split(value, ", ") {
+			if !planetListItem.MatchString(item) {
+				return false
+			}
+		}
+
+		return true
+	})
 }
 
+// FieldErrors maps each invalid field of a planet, by its JSON name, to what
+// is wrong with it
+type FieldErrors map[string]string
+
+func (errs FieldErrors) Error() string {
+	messages := []string{}
+	for field, message := range errs {
+		messages = append(messages, field+": "+message)
+	}
+	sort.Strings(messages)
+
+	return strings.Join(messages, "; ")
+}
+
+// DecodePlanet reads a planet from JSON, rejecting the fields a planet does
+// not have. Unknown fields and fields of the wrong type are reported as
+// FieldErrors.
+func DecodePlanet(data []byte) (Planet, error) {
+	planet := Planet{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&planet)
+	if err == nil && decoder.More() {
+		err = errors.New("only one planet was expected")
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return planet, FieldErrors{typeErr.Field: "must be a " + typeErr.Type.String()}
+	}
+
+	//encoding/json has no error type for unknown fields
+	if match := unknownField.FindStringSubmatch(fmt.Sprint(err)); match != nil {
+		return planet, FieldErrors{match[1]: "is not a field of a planet"}
+	}
+
+	return planet, err
+}
+
+// SplitList splits comma separated values, like the climate and terrain of
+// swapi planets ("temperate, tropical"), into lowercase trimmed items
+func SplitList(value string) []string {
+	items := []string{}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// Normalize trims the name of the planet, collapsing its inner spaces, and
+// turns its climate and terrain into lowercase comma separated lists, like
+// "temperate, tropical"
+func (planet *Planet) Normalize() {
+	planet.Name = strings.Join(strings.Fields(planet.Name), " ")
+	planet.Climate = strings.Join(SplitList(planet.Climate), ", ")
+	planet.Terrain = strings.Join(SplitList(planet.Terrain), ", ")
+}
+
+// Validate checks the planet as it would be stored once normalized, so blank
+// values are missing, reporting every invalid field as FieldErrors
 func (planet *Planet) Validate() error {
-	_, err := govalidator.ValidateStruct(planet)
+	normalized := *planet
+	normalized.Normalize()
+
+	_, err := govalidator.ValidateStruct(normalized)
 
 	if err != nil {
-		return err
+		return FieldErrors(govalidator.ErrorsByField(err))
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package models_test
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/Azuos0/b2w_challenge/app/models"
@@ -24,3 +25,59 @@ func TestPlanetValidation(t *testing.T) {
 	require.Nil(t, err1)
 	require.Error(t, err2)
 }
+
+func TestSplitList(t *testing.T) {
+	require.Equal(t, []string{"temperate", "tropical"}, models.SplitList(" Temperate,  tropical "))
+	require.Equal(t, []string{"arid"}, models.SplitList("arid,,"))
+	require.Empty(t, models.SplitList(" , "))
+}
+
+func TestPlanetNormalize(t *testing.T) {
+	planet := models.Planet{Name: "  Polis   Massa ", Climate: "Temperate,  TROPICAL,", Terrain: " Gas Giant "}
+	planet.Normalize()
+
+	require.Equal(t, "Polis Massa", planet.Name)
+	require.Equal(t, "temperate, tropical", planet.Climate)
+	require.Equal(t, "gas giant", planet.Terrain)
+}
+
+func TestPlanetValidationRules(t *testing.T) {
+	valid := models.Planet{Name: "Mon Cala", Climate: "Temperate, Humid", Terrain: "ocean, rocky-islands"}
+	require.Nil(t, valid.Validate())
+
+	invalid := models.Planet{
+		Name:    "   ",
+		Climate: "arid; windy",
+		Terrain: strings.Repeat("desert, ", 30),
+	}
+
+	err := invalid.Validate()
+	require.Equal(t, models.FieldErrors{
+		"name":    "Missing required field",
+		"climate": "must be a comma separated list of letters and numbers with spaces and the characters - '",
+		"terrain": "must have at most 200 characters",
+	}, err)
+
+	invalid = models.Planet{Name: "<script>", Climate: "arid", Terrain: "desert"}
+	require.Equal(t, models.FieldErrors{"name": "may only have letters and numbers with spaces and the characters - ' ."}, invalid.Validate())
+
+	invalid.Name = strings.Repeat("a", 101)
+	require.Equal(t, models.FieldErrors{"name": "must have at most 100 characters"}, invalid.Validate())
+}
+
+func TestDecodePlanet(t *testing.T) {
+	planet, err := models.DecodePlanet([]byte(`{"name": "Hoth", "climate": "frozen", "terrain": "tundra", "appearances": 1}`))
+	require.Nil(t, err)
+	require.Equal(t, "Hoth", planet.Name)
+
+	_, err = models.DecodePlanet([]byte(`{"name": "Hoth", "population": 0}`))
+	require.Equal(t, models.FieldErrors{"population": "is not a field of a planet"}, err)
+
+	_, err = models.DecodePlanet([]byte(`{"name": 42}`))
+	require.Equal(t, models.FieldErrors{"name": "must be a string"}, err)
+
+	_, err = models.DecodePlanet([]byte(`{"name": "Hoth"`))
+	_, isFieldErrors := err.(models.FieldErrors)
+	require.Error(t, err)
+	require.False(t, isFieldErrors)
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionRevert  = "revert"
+)
+
+// Revision is a snapshot of a planet right after one of its changes, numbered
+// from 1 on every planet
+type Revision struct {
+	ID       primitive.ObjectID `bson:"_id" json:"_id"`
+	PlanetID primitive.ObjectID `bson:"planetId" json:"planetId"`
+	Revision int                `bson:"revision" json:"revision"`
+	Action   string             `bson:"action" json:"action"`
+	Author   string             `bson:"author" json:"author"`
+	Planet   Planet             `bson:"planet" json:"planet"`
+	Changes  []FieldChange      `bson:"changes" json:"changes"`
+	// RevertedTo is the revision restored by a revert
+	RevertedTo int       `bson:"revertedTo,omitempty" json:"revertedTo,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// FieldChange is the value of a planet field, as shown on its JSON, before
+// and after a change. From is null for the fields set on creation.
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	From  interface{} `bson:"from" json:"from"`
+	To    interface{} `bson:"to" json:"to"`
+}
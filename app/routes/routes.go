@@ -20,9 +20,25 @@ func InitializeMainRouter(router *mux.Router) {
 	}).Methods("GET")
 }
 
+func InitializeHealthRoutes(router *mux.Router, controller *controller.HealthController) {
+	router.HandleFunc("/healthz", controller.Live()).Methods("GET")
+	router.HandleFunc("/readyz", controller.Ready()).Methods("GET")
+}
+
 func InititializePlanetRoutes(router *mux.Router, controller *controller.PlanetController) {
 	router.HandleFunc("/api/planets", controller.Search()).Methods("GET")
+	router.HandleFunc("/api/planets/trash", controller.Trash()).Methods("GET")
+	router.HandleFunc("/api/planets/export", controller.ExportPlanets()).Methods("GET")
+	router.HandleFunc("/api/planets/bulk", controller.BulkCreatePlanets()).Methods("POST")
+	router.HandleFunc("/api/planets/import", controller.ImportPlanets()).Methods("POST")
 	router.HandleFunc("/api/planet", controller.CreatePlanet()).Methods("POST")
 	router.HandleFunc("/api/planet/{id}", controller.GetPlanet()).Methods("GET")
+	router.HandleFunc("/api/planet/{id}", controller.UpdatePlanet()).Methods("PUT")
+	router.HandleFunc("/api/planet/{id}", controller.PatchPlanet()).Methods("PATCH")
 	router.HandleFunc("/api/planet/{id}", controller.DeletePlanet()).Methods("DELETE")
+	router.HandleFunc("/api/planet/{id}/refresh", controller.RefreshPlanet()).Methods("POST")
+	router.HandleFunc("/api/planet/{id}/restore", controller.RestorePlanet()).Methods("POST")
+	router.HandleFunc("/api/planet/{id}/history", controller.History()).Methods("GET")
+	router.HandleFunc("/api/planet/{id}/history/{rev}", controller.GetRevision()).Methods("GET")
+	router.HandleFunc("/api/planet/{id}/history/{rev}/revert", controller.RevertPlanet()).Methods("POST")
 }
@@ -1,39 +1,350 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/Azuos0/b2w_challenge/app/config"
 	"github.com/Azuos0/b2w_challenge/app/controller"
 	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/migrations"
 	"github.com/Azuos0/b2w_challenge/app/routes"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
 type App struct {
-	Router *mux.Router
-	DB     *mongo.Database
+	Config    config.Config
+	Router    *mux.Router
+	DB        *mongo.Database
+	Planets   services.PlanetRepository
+	Revisions services.RevisionRepository
+	Swapi     swapi.Client
+	Refresher *services.AppearancesRefresher
+	Purger    *services.TrashPurger
+	// degraded is 1 while the app runs without reaching mongo
+	degraded int32
+	// shuttingDown is 1 once Serve starts shutting the app down
+	shuttingDown int32
 }
 
-func (app *App) InitializeApp(uri string) {
+// MongoSettings are what the database package needs of the mongo config
+func MongoSettings(mongo config.Mongo) database.Settings {
+	return database.Settings{
+		URL:         mongo.URL,
+		Database:    mongo.Database,
+		MinPoolSize: mongo.MinPoolSize,
+		MaxPoolSize: mongo.MaxPoolSize,
+	}
+}
+
+// InitializeApp connects to the mongo database of the app config, failing
+// when it is not reachable within the connect timeout, unless the config
+// allows the app to start degraded
+func (app *App) InitializeApp() error {
 	var err error
+	settings := app.Config.Mongo
+
+	app.DB, err = database.Connect(MongoSettings(settings))
+
+	if err != nil {
+		return err
+	}
 
-	app.DB, err = database.Connect(uri)
+	err = database.Ping(context.Background(), app.DB, settings.ConnectTimeout)
+	if err != nil && !settings.AllowDegraded {
+		app.DB.Client().Disconnect(context.Background())
+		return fmt.Errorf("%w within %v, check MONGODB_URL", err, settings.ConnectTimeout)
+	}
 
 	if err != nil {
-		log.Println(err)
+		log.Printf("Starting degraded, the planet routes answer 503 until mongo is reachable: %v", err)
+		atomic.StoreInt32(&app.degraded, 1)
+	} else if err = app.migrate(); err != nil {
+		app.DB.Client().Disconnect(context.Background())
+		return err
+	}
+
+	app.Planets = services.NewMongoPlanetRepository(database.GetCollection(app.DB, "planets"))
+	app.Revisions = services.NewMongoRevisionRepository(database.GetCollection(app.DB, "planet_revisions"))
+	app.initializeRoutes()
+
+	return nil
+}
+
+// Degraded tells whether the app started without reaching mongo and did not
+// reach it since
+func (app *App) Degraded() bool {
+	return atomic.LoadInt32(&app.degraded) == 1
+}
+
+// reconnect waits for mongo to be reachable, leaving the degraded mode
+func (app *App) reconnect(ctx context.Context) {
+	if err := database.Ping(ctx, app.DB, 0); err != nil {
+		return
+	}
+
+	//the app keeps degraded rather than serving an outdated schema
+	if err := app.migrate(); err != nil {
+		log.Printf("Mongo is reachable but the app stays degraded: %v", err)
+		return
+	}
+
+	atomic.StoreInt32(&app.degraded, 0)
+	log.Println("Mongo is reachable, leaving the degraded mode")
+}
+
+// ShuttingDown tells whether the app stopped, being no longer ready to take
+// requests
+func (app *App) ShuttingDown() bool {
+	return atomic.LoadInt32(&app.shuttingDown) == 1
+}
+
+// migrate applies the pending migrations, unless the config says otherwise
+func (app *App) migrate() error {
+	if !app.Config.Mongo.MigrateOnStartup {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := migrations.NewRunner(app.DB, migrations.All).Up(ctx); err != nil {
+		return fmt.Errorf("%w, fix it and restart the app or set MIGRATE_ON_STARTUP=false", err)
+	}
+
+	return nil
+}
+
+// InitializeInMemoryApp starts the app without a database, keeping every
+// planet in process memory
+func (app *App) InitializeInMemoryApp() {
+	app.Planets = services.NewMemoryPlanetRepository()
+	app.Revisions = services.NewMemoryRevisionRepository()
+	app.initializeRoutes()
+}
+
+func (app *App) initializeRoutes() {
+	//a client may have been set beforehand, e.g. a fake one on tests
+	if app.Swapi == nil {
+		app.Swapi = app.newSwapiClient()
 	}
 
 	planetController := controller.PlanetController{}
-	planetController.SetService(app.DB)
+	planetController.SetRepository(app.Planets, app.Swapi)
+	planetController.PlanetService.Revisions = app.Revisions
+
+	limits := app.Config.Limits
+	if limits.MaxPageSize > 0 {
+		planetController.PlanetService.MaxPageSize = limits.MaxPageSize
+	}
+
+	if limits.MaxBulkSize > 0 {
+		planetController.PlanetService.MaxBulkSize = limits.MaxBulkSize
+	}
+
+	if limits.MaxImportSize > 0 {
+		planetController.PlanetService.MaxImportSize = limits.MaxImportSize
+	}
+
+	planetController.PlanetService.Timeouts = app.timeouts()
+
+	appearances := app.Config.Appearances
+	app.Refresher = services.NewAppearancesRefresher(planetController.PlanetService, appearances.RefreshInterval, appearances.MaxAge)
+
+	trash := app.Config.Trash
+	app.Purger = services.NewTrashPurger(planetController.PlanetService, trash.PurgeInterval, time.Duration(trash.RetentionDays)*24*time.Hour)
 
 	app.Router = mux.NewRouter()
 	routes.InitializeMainRouter(app.Router)
-	routes.InititializePlanetRoutes(app.Router, &planetController)
+	routes.InitializeHealthRoutes(app.Router, app.healthController())
+
+	planets := app.Router.NewRoute().Subrouter()
+	planets.Use(controller.RequireDatabase(app.Degraded))
+	routes.InititializePlanetRoutes(planets, &planetController)
 }
 
-func (app *App) Run(port string) {
-	log.Printf("Server listening at port %v \n", port)
-	log.Fatal(http.ListenAndServe(port, app.Router))
+// timeouts are the timeouts of the planet operations, keeping the default of
+// those not set
+func (app *App) timeouts() services.Timeouts {
+	timeouts := services.DefaultTimeouts
+
+	configured := app.Config.Timeouts
+
+	for _, setting := range []struct {
+		value   time.Duration
+		timeout *time.Duration
+	}{
+		{configured.Read, &timeouts.Read},
+		{configured.Write, &timeouts.Write},
+		{configured.Bulk, &timeouts.Bulk},
+		{configured.Export, &timeouts.Export},
+		{configured.Swapi, &timeouts.Swapi},
+	} {
+		if setting.value > 0 {
+			*setting.timeout = setting.value
+		}
+	}
+
+	return timeouts
+}
+
+// healthController checks mongo, when the app uses it, and swapi, when the
+// config asks to
+func (app *App) healthController() *controller.HealthController {
+	health := &controller.HealthController{
+		ShuttingDown: app.ShuttingDown,
+		Timeout:      app.Config.Health.Timeout,
+	}
+
+	if app.DB != nil {
+		health.Checks = append(health.Checks, controller.HealthCheck{
+			Name:     "mongo",
+			Critical: true,
+			Check: func(ctx context.Context) error {
+				return app.DB.Client().Ping(ctx, readpref.Primary())
+			},
+		})
+	}
+
+	if pinger, ok := app.Swapi.(swapi.Pinger); ok && app.Config.Health.CheckSwapi {
+		check := controller.HealthCheck{
+			Name:  "swapi",
+			Check: pinger.Ping,
+		}
+
+		//how often the cache answers tells how much the app depends on swapi
+		if cache, ok := app.Swapi.(*swapi.CachedClient); ok {
+			check.Details = func() interface{} {
+				return cache.Stats()
+			}
+		}
+
+		health.Checks = append(health.Checks, check)
+	}
+
+	return health
+}
+
+// newSwapiClient caches swapi lookups, persisting them on mongo when it is
+// available. The SWAPI_TIMEOUT bounds both a whole lookup and each request it
+// makes.
+func (app *App) newSwapiClient() swapi.Client {
+	var store swapi.CacheStore
+	if app.DB != nil {
+		store = swapi.NewMongoCacheStore(database.GetCollection(app.DB, "swapi_cache"))
+	}
+
+	timeout := app.timeouts().Swapi
+	settings := app.Config.Swapi
+	client := swapi.NewClient(settings.URL, &http.Client{Timeout: timeout})
+
+	cache := swapi.NewCachedClient(client, settings.CacheSize, settings.CacheTTL, store)
+	cache.Timeout = timeout
+
+	return cache
+}
+
+// Run serves the app on the port of its config until ctx is done, then shuts
+// it down as Serve does
+func (app *App) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", app.Config.Port)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Server listening at port %v \n", app.Config.Port)
+	return app.Serve(ctx, listener)
+}
+
+// Serve serves the app on listener, along with its background workers, until
+// ctx is done. The app is then reported as not ready, and after the shutdown
+// delay of the config, it stops taking requests and the workers, gives the
+// requests in flight the shutdown timeout of the config to finish before
+// cutting them off, waits for the workers and disconnects from mongo.
+func (app *App) Serve(ctx context.Context, listener net.Listener) error {
+	settings := app.Config.Server
+	server := &http.Server{
+		Handler:           app.Router,
+		ReadTimeout:       settings.ReadTimeout,
+		ReadHeaderTimeout: settings.ReadHeaderTimeout,
+		WriteTimeout:      settings.WriteTimeout,
+		IdleTimeout:       settings.IdleTimeout,
+	}
+
+	workers, stopWorkers := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	background := []func(context.Context){app.Refresher.Run, app.Purger.Run}
+	if app.Degraded() {
+		background = append(background, app.reconnect)
+	}
+
+	for _, worker := range background {
+		running.Add(1)
+		go func(run func(context.Context)) {
+			defer running.Done()
+			run(workers)
+		}(worker)
+	}
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	var err error
+	select {
+	case err = <-served:
+		//the server failed on its own, there is nothing left to drain
+	case <-ctx.Done():
+		atomic.StoreInt32(&app.shuttingDown, 1)
+
+		if settings.ShutdownDelay > 0 {
+			log.Printf("Shutting down in %v, no longer ready", settings.ShutdownDelay)
+			time.Sleep(settings.ShutdownDelay)
+		}
+
+		log.Println("Shutting down, waiting for the requests in flight")
+	}
+
+	var shutdown context.Context
+	var cancel context.CancelFunc
+	if settings.ShutdownTimeout > 0 {
+		shutdown, cancel = context.WithTimeout(context.Background(), settings.ShutdownTimeout)
+	} else {
+		shutdown, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	//the workers stop along with the requests in flight
+	stopWorkers()
+
+	if err == nil {
+		if err = server.Shutdown(shutdown); err != nil {
+			log.Printf("requests still in flight were cut off: %v", err)
+			server.Close()
+			err = nil
+		}
+	}
+
+	//workers check their context between operations, each one bound by the
+	//timeouts of the service
+	running.Wait()
+
+	if app.DB != nil {
+		if disconnectErr := app.DB.Client().Disconnect(shutdown); disconnectErr != nil {
+			log.Printf("disconnecting from mongo: %v", disconnectErr)
+		}
+	}
+
+	return err
 }
@@ -1,27 +1,247 @@
 package server_test
 
 import (
-	"os"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/Azuos0/b2w_challenge/app/config"
+	"github.com/Azuos0/b2w_challenge/app/config/configtest"
+	"github.com/Azuos0/b2w_challenge/app/controller"
+	"github.com/Azuos0/b2w_challenge/app/database"
 	"github.com/Azuos0/b2w_challenge/app/server"
-	"github.com/joho/godotenv"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/Azuos0/b2w_challenge/app/swapi/swapitest"
 	"github.com/stretchr/testify/require"
 )
 
 func TestInitializeApp(t *testing.T) {
+	app := server.App{Config: configtest.Config()}
+
+	err := app.InitializeApp()
+
+	require.Nil(t, err)
+
+	require.NotNil(t, app.DB)
+	require.NotNil(t, app.Router)
+}
+
+func TestInitializeInMemoryApp(t *testing.T) {
 	app := server.App{}
-	var err error
 
-	if os.Getenv("MONGODB_TEST_DATABASE") == "" {
-		err = godotenv.Load("../../.env")
+	app.InitializeInMemoryApp()
+
+	require.Nil(t, app.DB)
+	require.NotNil(t, app.Planets)
+	require.NotNil(t, app.Router)
+}
+
+func TestServeDrainsRequestsOnShutdown(t *testing.T) {
+	app := server.App{Config: config.Default()}
+	app.InitializeInMemoryApp()
+
+	started := make(chan struct{})
+	app.Router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Serve(ctx, listener)
+	}()
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		res, _ := http.Get("http://" + listener.Addr().String() + "/slow")
+		responses <- res
+	}()
+
+	<-started
+	stop()
+
+	//the request in flight is answered before Serve returns
+	res := <-responses
+	require.NotNil(t, res)
+	body, _ := io.ReadAll(res.Body)
+	require.Equal(t, "done", string(body))
+	require.Nil(t, <-served)
+
+	//and no new request is taken
+	_, err = http.Get("http://" + listener.Addr().String() + "/api")
+	require.Error(t, err)
+}
+
+func TestServeCutsOffRequestsAfterShutdownTimeout(t *testing.T) {
+	app := server.App{Config: config.Default()}
+	app.Config.Server.ShutdownTimeout = 50 * time.Millisecond
+	app.InitializeInMemoryApp()
+
+	started := make(chan struct{})
+	app.Router.HandleFunc("/hanging", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Serve(ctx, listener)
+	}()
+
+	go http.Get("http://" + listener.Addr().String() + "/hanging")
+
+	<-started
+	stop()
+
+	select {
+	case err := <-served:
+		require.Nil(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve did not return after the shutdown timeout")
 	}
+}
+
+func unreachableMongo() config.Config {
+	settings := config.Default()
+	//nothing listens on port 1
+	settings.Mongo.URL = "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100"
+	settings.Mongo.Database = "swapp_test"
+	settings.Mongo.ConnectTimeout = 300 * time.Millisecond
+
+	return settings
+}
+
+func TestInitializeAppFailsWithoutMongo(t *testing.T) {
+	app := server.App{Config: unreachableMongo()}
+
+	err := app.InitializeApp()
+
+	require.ErrorIs(t, err, database.ErrUnreachable)
+	require.Nil(t, app.Router)
+}
+
+func TestInitializeAppDegraded(t *testing.T) {
+	app := server.App{Config: unreachableMongo()}
+	app.Config.Mongo.AllowDegraded = true
+
+	err := app.InitializeApp()
 
 	require.Nil(t, err)
+	require.True(t, app.Degraded())
 
-	uri := os.Getenv("MONGODB_TEST_DATABASE")
-	app.InitializeApp(uri)
+	req, _ := http.NewRequest("GET", "/api/planets", nil)
+	res := httptest.NewRecorder()
+	app.Router.ServeHTTP(res, req)
 
-	require.NotNil(t, app.DB)
-	require.NotNil(t, app.Router)
+	require.Equal(t, http.StatusServiceUnavailable, res.Code)
+	require.Equal(t, "application/problem+json", res.Header().Get("Content-Type"))
+
+	var problem controller.Problem
+	json.Unmarshal(res.Body.Bytes(), &problem)
+	require.Equal(t, "upstream-unavailable", problem.Code)
+
+	//routes not depending on mongo are still served
+	req, _ = http.NewRequest("GET", "/api", nil)
+	res = httptest.NewRecorder()
+	app.Router.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestNotReadyDuringShutdownDelay(t *testing.T) {
+	app := server.App{Config: config.Default()}
+	app.Config.Server.ShutdownDelay = 300 * time.Millisecond
+	app.InitializeInMemoryApp()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- app.Serve(ctx, listener)
+	}()
+
+	res, err := http.Get("http://" + listener.Addr().String() + "/readyz")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	stop()
+	require.Eventually(t, app.ShuttingDown, time.Second, 10*time.Millisecond)
+
+	//requests are still served while load balancers notice the app is not ready
+	res, err = http.Get("http://" + listener.Addr().String() + "/readyz")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+
+	res, err = http.Get("http://" + listener.Addr().String() + "/healthz")
+	require.Nil(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.Nil(t, <-served)
+}
+
+func TestConfigDefaultsMatchThePackages(t *testing.T) {
+	defaults := config.Default()
+
+	require.Equal(t, swapi.DefaultBaseURL, defaults.Swapi.URL)
+	require.Equal(t, swapi.DefaultCacheTTL, defaults.Swapi.CacheTTL)
+	require.Equal(t, swapi.DefaultCacheSize, defaults.Swapi.CacheSize)
+	require.Equal(t, services.DefaultTimeouts, services.Timeouts(defaults.Timeouts))
+	require.Equal(t, int64(services.DefaultMaxPageSize), defaults.Limits.MaxPageSize)
+	require.Equal(t, services.DefaultMaxBulkSize, defaults.Limits.MaxBulkSize)
+	require.Equal(t, int64(services.DefaultMaxImportSize), defaults.Limits.MaxImportSize)
+	require.Equal(t, services.DefaultRefreshInterval, defaults.Appearances.RefreshInterval)
+	require.Equal(t, services.DefaultAppearancesMaxAge, defaults.Appearances.MaxAge)
+	require.Equal(t, services.DefaultTrashRetention, time.Duration(defaults.Trash.RetentionDays)*24*time.Hour)
+	require.Equal(t, services.DefaultPurgeInterval, defaults.Trash.PurgeInterval)
+}
+
+func TestSwapiClientUsesTheSwapiTimeout(t *testing.T) {
+	app := server.App{Config: config.Default()}
+	app.Config.Timeouts.Swapi = 3 * time.Second
+	app.InitializeInMemoryApp()
+
+	cache, ok := app.Swapi.(*swapi.CachedClient)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, cache.Timeout)
+
+	client, ok := cache.Client.(*swapi.HTTPClient)
+	require.True(t, ok)
+	require.Equal(t, 3*time.Second, client.HTTPClient.Timeout)
+}
+
+func TestReadyReportsSwapiCacheStats(t *testing.T) {
+	swapiServer := swapitest.NewServer(swapitest.Planets...)
+	defer swapiServer.Close()
+
+	app := server.App{Config: config.Default()}
+	app.Config.Swapi.URL = swapiServer.URL
+	app.Config.Health.CheckSwapi = true
+	app.InitializeInMemoryApp()
+
+	app.Swapi.LookupPlanet(context.Background(), "Tatooine")
+	app.Swapi.LookupPlanet(context.Background(), "tatooine")
+
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	res := httptest.NewRecorder()
+	app.Router.ServeHTTP(res, req)
+
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"details":{"hits":1,"misses":1}`)
 }
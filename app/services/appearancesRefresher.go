@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+)
+
+const (
+	DefaultRefreshInterval   = time.Hour
+	DefaultAppearancesMaxAge = 24 * time.Hour
+	DefaultRefreshBatchSize  = 100
+)
+
+// AppearancesRefresher periodically looks up again the planets whose swapi
+// lookup failed or is older than MaxAge
+type AppearancesRefresher struct {
+	Service   *PlanetService
+	Interval  time.Duration
+	MaxAge    time.Duration
+	BatchSize int64
+}
+
+func NewAppearancesRefresher(service *PlanetService, interval time.Duration, maxAge time.Duration) *AppearancesRefresher {
+	if interval <= 0 {
+		interval = DefaultRefreshInterval
+	}
+
+	if maxAge <= 0 {
+		maxAge = DefaultAppearancesMaxAge
+	}
+
+	return &AppearancesRefresher{
+		Service:   service,
+		Interval:  interval,
+		MaxAge:    maxAge,
+		BatchSize: DefaultRefreshBatchSize,
+	}
+}
+
+// Run refreshes stale planets every Interval until ctx is done
+func (refresher *AppearancesRefresher) Run(ctx context.Context) {
+	ticker := time.NewTicker(refresher.Interval)
+	defer ticker.Stop()
+
+	for {
+		refreshed, err := refresher.RefreshStale(ctx)
+		if err != nil {
+			log.Printf("appearances refresher: %v", err)
+		} else if refreshed > 0 {
+			log.Printf("appearances refresher: %v planets refreshed", refreshed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshStale refreshes one batch of stale planets, returning how many of
+// them could be resolved on swapi
+func (refresher *AppearancesRefresher) RefreshStale(ctx context.Context) (int, error) {
+	timeouts := refresher.Service.Timeouts
+
+	findCtx, cancel := withTimeout(ctx, timeouts.Read)
+	planets, err := refresher.Service.Repository.FindStale(findCtx, time.Now().Add(-refresher.MaxAge), refresher.BatchSize)
+	cancel()
+	if err != nil {
+		return 0, err
+	}
+
+	refreshed := 0
+	for i := range planets {
+		if ctx.Err() != nil {
+			return refreshed, ctx.Err()
+		}
+
+		planetCtx, cancel := withTimeout(ctx, timeouts.refresh())
+		err = refresher.Service.refresh(planetCtx, &planets[i])
+		cancel()
+
+		if errors.Is(err, ErrVersionMismatch) {
+			log.Printf("appearances refresher: planet %v skipped, it changed concurrently", planets[i].ID.Hex())
+			continue
+		}
+
+		if err != nil {
+			log.Printf("appearances refresher: planet %v: %v", planets[i].ID.Hex(), err)
+			continue
+		}
+
+		if planets[i].LookupStatus != string(swapi.StatusUpstreamError) {
+			refreshed++
+		}
+	}
+
+	return refreshed, nil
+}
@@ -0,0 +1,136 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/stretchr/testify/require"
+)
+
+type switchableClient struct {
+	down bool
+}
+
+func (client *switchableClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	if client.down {
+		return &swapi.LookupResult{Status: swapi.StatusUpstreamError}, errors.New("swapi is down")
+	}
+
+	return &swapi.LookupResult{Status: swapi.StatusMatched, Appearances: 5}, nil
+}
+
+func TestCreatePlanetWhileSwapiIsDown(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{down: true})
+
+	planet, err := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+
+	require.Nil(t, err)
+	require.Equal(t, 0, planet.Appearances)
+	require.Equal(t, string(swapi.StatusUpstreamError), planet.LookupStatus)
+	require.True(t, planet.AppearancesUpdatedAt.IsZero())
+}
+
+func TestRefreshStalePlanets(t *testing.T) {
+	client := &switchableClient{down: true}
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), client)
+	refresher := services.NewAppearancesRefresher(service, time.Hour, time.Hour)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+
+	refreshed, err := refresher.RefreshStale(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, refreshed)
+
+	client.down = false
+
+	refreshed, err = refresher.RefreshStale(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 1, refreshed)
+
+	planet, _ = service.Get(context.Background(), planet.ID.Hex())
+	require.Equal(t, 5, planet.Appearances)
+	require.Equal(t, string(swapi.StatusMatched), planet.LookupStatus)
+	require.False(t, planet.AppearancesUpdatedAt.IsZero())
+
+	//the planet is up to date now
+	refreshed, err = refresher.RefreshStale(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, refreshed)
+}
+
+func TestRefreshKeepsAppearancesWhenSwapiFails(t *testing.T) {
+	client := &switchableClient{}
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), client)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	client.down = true
+
+	refreshed, err := service.Refresh(context.Background(), planet.ID.Hex(), 0)
+
+	require.Nil(t, err)
+	require.Equal(t, 5, refreshed.Appearances)
+	require.Equal(t, planet.AppearancesUpdatedAt, refreshed.AppearancesUpdatedAt)
+	require.Equal(t, string(swapi.StatusUpstreamError), refreshed.LookupStatus)
+}
+
+func TestRefresherRunStopsWithContext(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+	refresher := services.NewAppearancesRefresher(service, time.Millisecond, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		refresher.Run(ctx)
+		close(done)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("refresher did not stop")
+	}
+}
+
+// renamingClient renames the planet it looks up the first time, as a PUT
+// racing the refresher would
+type renamingClient struct {
+	service *services.PlanetService
+	renamed bool
+}
+
+func (client *renamingClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	if !client.renamed {
+		client.renamed = true
+		planet, _ := client.service.Repository.FindByName(ctx, name)
+		client.service.Update(ctx, planet.ID.Hex(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"}, planet.Version)
+
+		return &swapi.LookupResult{Status: swapi.StatusMatched, Appearances: 5}, nil
+	}
+
+	return &swapi.LookupResult{Status: swapi.StatusMatched, Appearances: 1}, nil
+}
+
+func TestRefreshSkipsPlanetsChangedConcurrently(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{down: true})
+	refresher := services.NewAppearancesRefresher(service, time.Hour, time.Hour)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	service.Swapi = &renamingClient{service: service}
+
+	refreshed, err := refresher.RefreshStale(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, 0, refreshed)
+
+	//the lookup of Tatooine is not written over Hoth
+	planet, _ = service.Get(context.Background(), planet.ID.Hex())
+	require.Equal(t, "Hoth", planet.Name)
+	require.Equal(t, 1, planet.Appearances)
+}
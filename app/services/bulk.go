@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+)
+
+const (
+	DefaultMaxBulkSize = 100
+	// bulkLookups bounds the swapi lookups BulkCreate makes at once
+	bulkLookups = 8
+)
+
+const (
+	BulkCreated   = "created"
+	BulkInvalid   = "invalid"
+	BulkDuplicate = "duplicate"
+	BulkFailed    = "failed"
+)
+
+// errStorageUnavailable is the error sent for the planets that failed to be
+// stored, the error of the database being only logged
+const errStorageUnavailable = "storage unavailable"
+
+// BulkResult is the outcome of one of the planets sent to BulkCreate
+type BulkResult struct {
+	Index  int            `json:"index"`
+	Status string         `json:"status"`
+	Planet *models.Planet `json:"planet,omitempty"`
+	// Errors are the validation errors of an invalid planet, keyed by field
+	Errors map[string]string `json:"errors,omitempty"`
+	// ExistingID is the id of the planet that already has the name of a duplicate
+	ExistingID string `json:"existingId,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Created   int          `json:"created"`
+	Invalid   int          `json:"invalid"`
+	Duplicate int          `json:"duplicate"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+// BulkCreate creates every valid planet among items, each one a JSON planet
+// as taken by Create, and reports the outcome of each of them in order
+func (client *PlanetService) BulkCreate(ctx context.Context, items []json.RawMessage) (*BulkResponse, error) {
+	if client.MaxBulkSize > 0 && len(items) > client.MaxBulkSize {
+		return nil, &ErrBulkTooLarge{Max: client.MaxBulkSize}
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Bulk)
+	defer cancel()
+
+	results := make([]BulkResult, len(items))
+	planets := []models.Planet{}
+	//indexes holds the position in items of each planet
+	indexes := []int{}
+
+	for i, item := range items {
+		results[i].Index = i
+		planet, err := models.DecodePlanet(item)
+		if err == nil {
+			err = validate(&planet)
+		}
+
+		if err != nil {
+			results[i].Status = BulkInvalid
+			results[i].Errors = fieldErrors(err, "planet")
+			continue
+		}
+
+		planets = append(planets, newPlanet(planet))
+		indexes = append(indexes, i)
+	}
+
+	created, err := client.createAll(ctx, planets)
+	if err != nil {
+		return nil, err
+	}
+
+	for j, result := range created {
+		result.Index = indexes[j]
+		results[indexes[j]] = result
+	}
+
+	response := BulkResponse{Results: results}
+	for _, result := range results {
+		switch result.Status {
+		case BulkCreated:
+			response.Created++
+		case BulkInvalid:
+			response.Invalid++
+		case BulkDuplicate:
+			response.Duplicate++
+		case BulkFailed:
+			response.Failed++
+		}
+	}
+
+	return &response, nil
+}
+
+// fieldErrors lists the invalid fields of a planet, or keeps the whole error
+// under key when it could not be read
+func fieldErrors(err error, key string) map[string]string {
+	validation := NewErrValidation(err)
+	if validation.Fields != nil {
+		return validation.Fields
+	}
+
+	return map[string]string{key: err.Error()}
+}
+
+// createAll creates planets, already validated, returning the outcome of each
+// one in order
+func (client *PlanetService) createAll(ctx context.Context, planets []models.Planet) ([]BulkResult, error) {
+	results := make([]BulkResult, len(planets))
+
+	client.resolveAll(ctx, planets)
+
+	failed, err := client.Repository.InsertMany(ctx, planets)
+	if err != nil {
+		return nil, storageError(err, nil)
+	}
+
+	for j, planet := range planets {
+		result := &results[j]
+
+		if err, ok := failed[j]; ok {
+			if conflict, ok := client.conflictError(ctx, planet, err).(*ErrConflict); ok {
+				result.Status = BulkDuplicate
+				result.Error = conflict.Error()
+				result.ExistingID = conflict.ExistingID
+				continue
+			}
+
+			log.Printf("bulk create of planet %q: %v", planet.Name, err)
+			result.Status = BulkFailed
+			result.Error = errStorageUnavailable
+			continue
+		}
+
+		created := storedPlanet(planet)
+		result.Status = BulkCreated
+		result.Planet = &created
+		client.recordRevision(ctx, models.ActionCreate, nil, created, 0)
+	}
+
+	return results, nil
+}
+
+// resolveAll looks the planets up on swapi, at most bulkLookups at a time
+func (client *PlanetService) resolveAll(ctx context.Context, planets []models.Planet) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, bulkLookups)
+
+	for i := range planets {
+		wg.Add(1)
+		slots <- struct{}{}
+
+		go func(planet *models.Planet) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			client.resolveAppearances(ctx, planet)
+			planet.CreatedAt = time.Now()
+		}(&planets[i])
+	}
+
+	wg.Wait()
+}
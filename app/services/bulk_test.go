@@ -0,0 +1,161 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrencyClient records how many lookups run at the same time
+type concurrencyClient struct {
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (client *concurrencyClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	client.mu.Lock()
+	client.running++
+	if client.running > client.max {
+		client.max = client.running
+	}
+	client.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	client.mu.Lock()
+	client.running--
+	client.mu.Unlock()
+
+	return &swapi.LookupResult{Status: swapi.StatusNotFound}, nil
+}
+
+func bulkItems(items ...string) []json.RawMessage {
+	raw := []json.RawMessage{}
+	for _, item := range items {
+		raw = append(raw, json.RawMessage(item))
+	}
+
+	return raw
+}
+
+func TestBulkCreate(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+	hoth, _ := service.Create(context.Background(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	res, err := service.BulkCreate(context.Background(), bulkItems(
+		`{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`,
+		`{"name": "Dagobah", "climate": "murky"}`,
+		`"Naboo"`,
+		`{"name": "tatooine", "climate": "arid", "terrain": "desert"}`,
+		`{"name": "HOTH", "climate": "frozen", "terrain": "tundra"}`,
+		`{"name": "Alderaan", "climate": "temperate", "terrain": "grasslands"}`,
+	))
+
+	require.Nil(t, err)
+	require.Equal(t, 2, res.Created)
+	require.Equal(t, 2, res.Invalid)
+	require.Equal(t, 2, res.Duplicate)
+	require.Equal(t, 0, res.Failed)
+	require.Len(t, res.Results, 6)
+
+	require.Equal(t, services.BulkCreated, res.Results[0].Status)
+	require.Equal(t, 5, res.Results[0].Planet.Appearances)
+	require.Equal(t, int64(1), res.Results[0].Planet.Version)
+
+	require.Equal(t, services.BulkInvalid, res.Results[1].Status)
+	require.Equal(t, "Missing required field", res.Results[1].Errors["terrain"])
+
+	require.Equal(t, services.BulkInvalid, res.Results[2].Status)
+	require.Contains(t, res.Results[2].Errors, "planet")
+
+	require.Equal(t, services.BulkDuplicate, res.Results[3].Status)
+	require.Equal(t, res.Results[0].Planet.ID.Hex(), res.Results[3].ExistingID)
+
+	require.Equal(t, services.BulkDuplicate, res.Results[4].Status)
+	require.Equal(t, hoth.ID.Hex(), res.Results[4].ExistingID)
+
+	require.Equal(t, services.BulkCreated, res.Results[5].Status)
+	require.Equal(t, 5, res.Results[5].Index)
+
+	created, err := service.Get(context.Background(), res.Results[5].Planet.ID.Hex())
+	require.Nil(t, err)
+	require.Equal(t, *res.Results[5].Planet, *created)
+
+	history, _ := service.History(context.Background(), created.ID.Hex())
+	require.Len(t, history, 1)
+	require.Equal(t, models.ActionCreate, history[0].Action)
+}
+
+func TestBulkCreateTooLarge(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+	service.MaxBulkSize = 1
+
+	_, err := service.BulkCreate(context.Background(), bulkItems(`{}`, `{}`))
+
+	var tooLarge *services.ErrBulkTooLarge
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, 1, tooLarge.Max)
+}
+
+func TestBulkCreateBoundsLookups(t *testing.T) {
+	client := &concurrencyClient{}
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), client)
+
+	items := []string{}
+	for i := 0; i < 40; i++ {
+		items = append(items, fmt.Sprintf(`{"name": "Planet %v", "climate": "arid", "terrain": "desert"}`, i))
+	}
+
+	res, err := service.BulkCreate(context.Background(), bulkItems(items...))
+
+	require.Nil(t, err)
+	require.Equal(t, 40, res.Created)
+	require.Greater(t, client.max, 1)
+	require.LessOrEqual(t, client.max, 8)
+}
+
+// brokenRepository fails every planet stored, and every name looked up, as a
+// database dropping the connection would
+type brokenRepository struct {
+	*services.MemoryPlanetRepository
+}
+
+func (brokenRepository) InsertMany(ctx context.Context, planets []models.Planet) (map[int]error, error) {
+	failed := map[int]error{}
+	for i := range planets {
+		failed[i] = errors.New("connection(mongodb:27017[-3]) incomplete read of message header")
+	}
+
+	return failed, nil
+}
+
+func (brokenRepository) FindByName(ctx context.Context, name string) (*models.Planet, error) {
+	return nil, errors.New("connection(mongodb:27017[-3]) incomplete read of message header")
+}
+
+func TestStorageFailuresDoNotLeakDriverErrors(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(brokenRepository{services.NewMemoryPlanetRepository()}, swapiClient)
+
+	res, err := service.BulkCreate(context.Background(), bulkItems(`{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`))
+	require.Nil(t, err)
+	require.Equal(t, 1, res.Failed)
+	require.Equal(t, services.BulkFailed, res.Results[0].Status)
+	require.Equal(t, "storage unavailable", res.Results[0].Error)
+
+	file := `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}`
+	imported, err := service.Import(context.Background(), strings.NewReader(file), services.FormatNDJSON, true)
+	require.Nil(t, err)
+	require.Equal(t, 1, imported.Failed)
+	require.Equal(t, "storage unavailable", imported.Errors[0].Error)
+}
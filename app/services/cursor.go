@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a planet in the (createdAt, _id) order used by
+// cursor pagination
+type Cursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+type cursorPayload struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+}
+
+// Encode returns the opaque representation of the cursor sent to clients
+func (cursor Cursor) Encode() string {
+	payload, _ := json.Marshal(cursorPayload{
+		CreatedAt: cursor.CreatedAt.UnixNano() / int64(time.Millisecond),
+		ID:        cursor.ID.Hex(),
+	})
+
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func DecodeCursor(value string) (*Cursor, error) {
+	payload := cursorPayload{}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	err = json.Unmarshal(data, &payload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(payload.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{
+		CreatedAt: time.Unix(0, payload.CreatedAt*int64(time.Millisecond)).UTC(),
+		ID:        id,
+	}, nil
+}
+
+func cursorOf(planet models.Planet) Cursor {
+	return Cursor{CreatedAt: planet.CreatedAt, ID: planet.ID}
+}
+
+// query matches the planets coming after the cursor
+func (cursor Cursor) query() bson.M {
+	return bson.M{"$or": []bson.M{
+		{"createdAt": bson.M{"$gt": cursor.CreatedAt}},
+		{"createdAt": cursor.CreatedAt, "_id": bson.M{"$gt": cursor.ID}},
+	}}
+}
+
+// after tells whether the planet comes after the cursor, like query does
+func (cursor Cursor) after(planet models.Planet) bool {
+	if planet.CreatedAt.Equal(cursor.CreatedAt) {
+		return bytes.Compare(planet.ID[:], cursor.ID[:]) > 0
+	}
+
+	return planet.CreatedAt.After(cursor.CreatedAt)
+}
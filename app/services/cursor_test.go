@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorEncoding(t *testing.T) {
+	cursor := services.Cursor{
+		CreatedAt: time.Date(2021, time.May, 10, 12, 30, 0, 123000000, time.UTC),
+		ID:        primitive.NewObjectID(),
+	}
+
+	decoded, err := services.DecodeCursor(cursor.Encode())
+
+	require.Nil(t, err)
+	require.Equal(t, cursor, *decoded)
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, value := range []string{"not base64!", "bm90IGpzb24", "eyJ0IjoxLCJpZCI6Inh5eiJ9"} {
+		_, err := services.DecodeCursor(value)
+
+		require.Equal(t, services.ErrInvalidCursor, err, value)
+	}
+}
+
+func TestSearchByCursorIsStableAcrossChanges(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
+	created := []*models.Planet{}
+
+	for i := 0; i < 5; i++ {
+		planet, _ := service.Create(context.Background(), models.Planet{Name: fmt.Sprintf("Planet %v", i), Climate: "Arid", Terrain: "Desert"})
+		created = append(created, planet)
+	}
+
+	res, err := service.SearchByCursor(context.Background(), services.SearchFilter{}, nil, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Planet 0", "Planet 1"}, names(res.Result))
+	require.NotEmpty(t, res.NextCursor)
+
+	//deleting an already listed planet and creating a new one don't shift the next page
+	service.Delete(context.Background(), created[0].ID.Hex(), 0)
+	service.Create(context.Background(), models.Planet{Name: "Planet 5", Climate: "Arid", Terrain: "Desert"})
+
+	cursor, _ := services.DecodeCursor(res.NextCursor)
+	res, err = service.SearchByCursor(context.Background(), services.SearchFilter{}, cursor, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Planet 2", "Planet 3"}, names(res.Result))
+
+	cursor, _ = services.DecodeCursor(res.NextCursor)
+	res, err = service.SearchByCursor(context.Background(), services.SearchFilter{}, cursor, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Planet 4", "Planet 5"}, names(res.Result))
+	require.Empty(t, res.NextCursor)
+
+	clearDatabase(repository)
+}
+
+func TestSearchByCursorWithNameFilter(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
+
+	for _, name := range []string{"Tatooine", "Hoth", "Tund", "Naboo", "Tholoth"} {
+		service.Create(context.Background(), models.Planet{Name: name, Climate: "Arid", Terrain: "Desert"})
+	}
+
+	res, err := service.SearchByCursor(context.Background(), services.SearchFilter{Name: "^t"}, nil, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Tatooine", "Tund"}, names(res.Result))
+
+	cursor, _ := services.DecodeCursor(res.NextCursor)
+	res, err = service.SearchByCursor(context.Background(), services.SearchFilter{Name: "^t"}, cursor, 2)
+	require.Nil(t, err)
+	require.Equal(t, []string{"Tholoth"}, names(res.Result))
+	require.Empty(t, res.NextCursor)
+
+	clearDatabase(repository)
+}
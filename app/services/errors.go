@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when the planet, or one of its revisions, does not
+// exist
+type ErrNotFound struct {
+	// Resource is what was looked for, like "planet" or "revision"
+	Resource string
+	ID       string
+}
+
+func (e *ErrNotFound) Error() string {
+	return fmt.Sprintf("no %v with this id was found in this so far far away galaxy", e.Resource)
+}
+
+// ErrInvalidID is returned when a planet id is not an ObjectID
+type ErrInvalidID struct {
+	ID string
+}
+
+func (e *ErrInvalidID) Error() string {
+	return fmt.Sprintf("%q is not a valid planet id", e.ID)
+}
+
+// ErrValidation is returned when a planet sent by the client is not valid.
+// Fields holds the message of each invalid field, while Detail explains a
+// planet that could not be read at all.
+type ErrValidation struct {
+	Fields map[string]string
+	Detail string
+}
+
+func (e *ErrValidation) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+
+	return models.FieldErrors(e.Fields).Error()
+}
+
+// NewErrValidation reports why a planet sent by the client is not valid,
+// keeping the invalid fields when err has them, as models.FieldErrors does
+func NewErrValidation(err error) *ErrValidation {
+	var validation *ErrValidation
+	if errors.As(err, &validation) {
+		return validation
+	}
+
+	var fields models.FieldErrors
+	if errors.As(err, &fields) {
+		return &ErrValidation{Fields: fields}
+	}
+
+	return &ErrValidation{Detail: err.Error()}
+}
+
+// ErrUpstream is returned when a service the planets depend on, like the
+// database, fails. Err is meant for the logs, not for the client.
+type ErrUpstream struct {
+	Service string
+	Err     error
+}
+
+func (e *ErrUpstream) Error() string {
+	return fmt.Sprintf("%v: %v", e.Service, e.Err)
+}
+
+func (e *ErrUpstream) Unwrap() error {
+	return e.Err
+}
+
+// ErrBulkTooLarge is returned when more planets than allowed are sent at once
+type ErrBulkTooLarge struct {
+	Max int
+}
+
+func (e *ErrBulkTooLarge) Error() string {
+	return fmt.Sprintf("up to %v planets can be created at once", e.Max)
+}
+
+// ErrImportTooLarge is returned when the file sent to Import is larger than
+// allowed
+type ErrImportTooLarge struct {
+	// Max is the size of the largest file, in bytes
+	Max int64
+}
+
+func (e *ErrImportTooLarge) Error() string {
+	return fmt.Sprintf("the file must have up to %v bytes", e.Max)
+}
+
+// ErrImportIncomplete is returned when an import stops after some of its
+// planets were created, which are kept. Err tells why it stopped.
+type ErrImportIncomplete struct {
+	Created int
+	Err     error
+}
+
+func (e *ErrImportIncomplete) Error() string {
+	return fmt.Sprintf("the import stopped after creating %v planets: %v", e.Created, e.Err)
+}
+
+func (e *ErrImportIncomplete) Unwrap() error {
+	return e.Err
+}
+
+// ErrVersionMismatch is returned when the planet was written since the
+// version the client expected
+var ErrVersionMismatch = errors.New("the planet was changed since this version, fetch it again")
+
+// ErrConflict is returned when a planet with the same name already exists.
+// Trashed tells the planet is in the trash, where it keeps its name until it
+// is restored or purged.
+type ErrConflict struct {
+	Name       string
+	ExistingID string
+	Trashed    bool
+}
+
+func (e *ErrConflict) Error() string {
+	if e.Trashed {
+		return fmt.Sprintf("a planet named %v is in the trash of this galaxy, restore it or wait for it to be purged", e.Name)
+	}
+
+	return fmt.Sprintf("a planet named %v already exists in this galaxy", e.Name)
+}
+
+// parseID reads the id of a planet sent by the client
+func parseID(id string) (primitive.ObjectID, error) {
+	_id, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return _id, &ErrInvalidID{ID: id}
+	}
+
+	return _id, nil
+}
+
+func planetNotFound(id primitive.ObjectID) error {
+	return &ErrNotFound{Resource: "planet", ID: id.Hex()}
+}
+
+// storageError turns an error of the repositories into notFound, when the
+// document does not exist, or into an ErrUpstream. Errors of a context that
+// was cancelled or ran out of time are kept.
+func storageError(err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if err == mongo.ErrNoDocuments && notFound != nil {
+		return notFound
+	}
+
+	return &ErrUpstream{Service: "database", Err: err}
+}
+
+// validate normalizes a planet sent by the client and checks its fields
+func validate(planet *models.Planet) error {
+	planet.Normalize()
+
+	if err := planet.Validate(); err != nil {
+		return NewErrValidation(err)
+	}
+
+	return nil
+}
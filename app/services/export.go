@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+)
+
+const (
+	FormatJSON = "json"
+	// exportFlushSize is how many planets Export writes between flushes
+	exportFlushSize = 100
+)
+
+// ErrInvalidExport is returned when Export is asked for an unknown format
+var ErrInvalidExport = errors.New("invalid export format")
+
+// ExportColumns are the CSV columns written by Export, in order
+var ExportColumns = []string{"_id", "name", "climate", "terrain", "appearances", "lookupStatus", "createdAt", "version"}
+
+// flusher is implemented by writers holding data back, as an
+// http.ResponseWriter does
+type flusher interface {
+	Flush()
+}
+
+// ExportResult tells how much of an export was written
+type ExportResult struct {
+	// Planets is the number of planets written
+	Planets int
+	// Written tells whether anything was written at all, the planets or only
+	// the beginning of the file, like the CSV header
+	Written bool
+}
+
+// exportOutput tracks whether anything was written to w
+type exportOutput struct {
+	w       io.Writer
+	written bool
+}
+
+func (out *exportOutput) Write(p []byte) (int, error) {
+	n, err := out.w.Write(p)
+	if n > 0 {
+		out.written = true
+	}
+
+	return n, err
+}
+
+func (out *exportOutput) Flush() {
+	flush(out.w)
+}
+
+// exportWriter writes the planets of an export in one of its formats
+type exportWriter interface {
+	// begin is called before the first planet is written
+	begin() error
+	write(planet models.Planet) error
+	// end is called after the last planet, even when there was none
+	end() error
+	flush() error
+}
+
+// Export writes the planets matching filter to w, in the order of sort, as a
+// CSV, NDJSON or JSON file. Planets are read and written one at a time, with w
+// flushed every few of them, so memory use does not grow with their number.
+// Nothing is written to w until the first planet is read, which lets a
+// failing export with no output still be answered with an error; how much
+// was written is returned along with any error.
+func (client *PlanetService) Export(ctx context.Context, w io.Writer, format string, filter SearchFilter, sort []SortField) (ExportResult, error) {
+	out := &exportOutput{w: w}
+
+	count, err := client.export(ctx, out, format, filter, sort)
+
+	return ExportResult{Planets: count, Written: out.written}, err
+}
+
+func (client *PlanetService) export(ctx context.Context, w io.Writer, format string, filter SearchFilter, sort []SortField) (int, error) {
+	writer, err := newExportWriter(w, format)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Export)
+	defer cancel()
+
+	count := 0
+
+	err = client.Repository.ForEach(ctx, filter, sort, func(planet models.Planet) error {
+		if count == 0 {
+			if err := writer.begin(); err != nil {
+				return err
+			}
+		}
+
+		if err := writer.write(planet); err != nil {
+			return err
+		}
+		count++
+
+		if count%exportFlushSize == 0 {
+			return writer.flush()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return count, err
+	}
+
+	if count == 0 {
+		if err := writer.begin(); err != nil {
+			return count, err
+		}
+	}
+
+	if err := writer.end(); err != nil {
+		return count, err
+	}
+
+	return count, writer.flush()
+}
+
+func newExportWriter(w io.Writer, format string) (exportWriter, error) {
+	switch format {
+	case FormatCSV:
+		return &csvExport{w: w, csv: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &ndjsonExport{w: w, encoder: json.NewEncoder(w)}, nil
+	case FormatJSON:
+		return &jsonExport{w: w}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %v, use %v, %v or %v", ErrInvalidExport, format, FormatCSV, FormatNDJSON, FormatJSON)
+}
+
+// flush sends what was written so far to the client, when w supports it
+func flush(w io.Writer) {
+	if f, ok := w.(flusher); ok {
+		f.Flush()
+	}
+}
+
+// csvExport writes a header with ExportColumns and then a row per planet
+type csvExport struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+func (export *csvExport) begin() error {
+	return export.csv.Write(ExportColumns)
+}
+
+func (export *csvExport) write(planet models.Planet) error {
+	return export.csv.Write([]string{
+		planet.ID.Hex(),
+		planet.Name,
+		planet.Climate,
+		planet.Terrain,
+		strconv.Itoa(planet.Appearances),
+		planet.LookupStatus,
+		planet.CreatedAt.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(planet.Version, 10),
+	})
+}
+
+func (export *csvExport) end() error {
+	return nil
+}
+
+func (export *csvExport) flush() error {
+	export.csv.Flush()
+	if err := export.csv.Error(); err != nil {
+		return err
+	}
+
+	flush(export.w)
+	return nil
+}
+
+// ndjsonExport writes each planet as JSON on its own line
+type ndjsonExport struct {
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+func (export *ndjsonExport) begin() error {
+	return nil
+}
+
+func (export *ndjsonExport) write(planet models.Planet) error {
+	return export.encoder.Encode(planet)
+}
+
+func (export *ndjsonExport) end() error {
+	return nil
+}
+
+func (export *ndjsonExport) flush() error {
+	flush(export.w)
+	return nil
+}
+
+// jsonExport writes the planets as a JSON array, one element at a time
+type jsonExport struct {
+	w       io.Writer
+	written bool
+}
+
+func (export *jsonExport) begin() error {
+	_, err := io.WriteString(export.w, "[")
+	return err
+}
+
+func (export *jsonExport) write(planet models.Planet) error {
+	body, err := json.Marshal(planet)
+	if err != nil {
+		return err
+	}
+
+	if export.written {
+		if _, err := io.WriteString(export.w, ",\n"); err != nil {
+			return err
+		}
+	} else {
+		if _, err := io.WriteString(export.w, "\n"); err != nil {
+			return err
+		}
+	}
+	export.written = true
+
+	_, err = export.w.Write(body)
+	return err
+}
+
+func (export *jsonExport) end() error {
+	closing := "]\n"
+	if export.written {
+		closing = "\n]\n"
+	}
+
+	_, err := io.WriteString(export.w, closing)
+	return err
+}
+
+func (export *jsonExport) flush() error {
+	flush(export.w)
+	return nil
+}
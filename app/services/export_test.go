@@ -0,0 +1,161 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+)
+
+// flushRecorder counts the flushes of an export
+type flushRecorder struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (recorder *flushRecorder) Flush() {
+	recorder.flushes++
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// closingWriter fails every write after the first open ones
+type closingWriter struct {
+	open int
+}
+
+func (writer *closingWriter) Write(p []byte) (int, error) {
+	if writer.open == 0 {
+		return 0, errors.New("connection reset")
+	}
+	writer.open--
+
+	return len(p), nil
+}
+
+func newExportService(t *testing.T) *services.PlanetService {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	for _, planet := range []models.Planet{
+		{Name: "Tatooine", Climate: "arid", Terrain: "desert"},
+		{Name: "Hoth", Climate: "frozen", Terrain: "tundra, ice caves"},
+		{Name: "Dagobah", Climate: "murky", Terrain: "swamp"},
+	} {
+		_, err := service.Create(context.Background(), planet)
+		require.Nil(t, err)
+	}
+
+	return service
+}
+
+func TestExportCSV(t *testing.T) {
+	service := newExportService(t)
+	var out bytes.Buffer
+
+	res, err := service.Export(context.Background(), &out, services.FormatCSV, services.SearchFilter{}, []services.SortField{{Field: "name"}})
+
+	require.Nil(t, err)
+	require.Equal(t, 3, res.Planets)
+
+	records, err := csv.NewReader(&out).ReadAll()
+	require.Nil(t, err)
+	require.Len(t, records, 4)
+	require.Equal(t, services.ExportColumns, records[0])
+	require.Equal(t, "Dagobah", records[1][1])
+	require.Equal(t, "tundra, ice caves", records[2][3])
+	require.Equal(t, "1", records[3][7])
+}
+
+func TestExportNDJSONWithFilter(t *testing.T) {
+	service := newExportService(t)
+	var out bytes.Buffer
+
+	res, err := service.Export(context.Background(), &out, services.FormatNDJSON, services.SearchFilter{Climates: []string{"arid", "frozen"}}, nil)
+
+	require.Nil(t, err)
+	require.Equal(t, 2, res.Planets)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	planet := models.Planet{}
+	require.Nil(t, json.Unmarshal([]byte(lines[0]), &planet))
+	require.Equal(t, "Tatooine", planet.Name)
+}
+
+func TestExportJSON(t *testing.T) {
+	service := newExportService(t)
+	var out bytes.Buffer
+
+	_, err := service.Export(context.Background(), &out, services.FormatJSON, services.SearchFilter{}, nil)
+	require.Nil(t, err)
+
+	planets := []models.Planet{}
+	require.Nil(t, json.Unmarshal(out.Bytes(), &planets))
+	require.Len(t, planets, 3)
+
+	//an empty export is still a valid file
+	out.Reset()
+	res, err := service.Export(context.Background(), &out, services.FormatJSON, services.SearchFilter{Name: "Naboo"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, 0, res.Planets)
+	require.Nil(t, json.Unmarshal(out.Bytes(), &planets))
+	require.Empty(t, planets)
+
+	out.Reset()
+	_, err = service.Export(context.Background(), &out, services.FormatCSV, services.SearchFilter{Name: "Naboo"}, nil)
+	require.Nil(t, err)
+	require.Equal(t, strings.Join(services.ExportColumns, ",")+"\n", out.String())
+}
+
+func TestExportFlushesAsItWrites(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+
+	items := []json.RawMessage{}
+	for i := 0; i < 250; i++ {
+		body, _ := json.Marshal(models.Planet{Name: fmt.Sprintf("Planet %v", i), Climate: "arid", Terrain: "desert"})
+		items = append(items, body)
+	}
+	service.MaxBulkSize = len(items)
+	_, err := service.BulkCreate(context.Background(), items)
+	require.Nil(t, err)
+
+	out := &flushRecorder{}
+	res, err := service.Export(context.Background(), out, services.FormatNDJSON, services.SearchFilter{}, nil)
+
+	require.Nil(t, err)
+	require.Equal(t, 250, res.Planets)
+	//every 100 planets and once at the end
+	require.Equal(t, 3, out.flushes)
+}
+
+func TestExportErrors(t *testing.T) {
+	service := newExportService(t)
+
+	res, err := service.Export(context.Background(), &bytes.Buffer{}, "xml", services.SearchFilter{}, nil)
+	require.ErrorIs(t, err, services.ErrInvalidExport)
+	require.Equal(t, 0, res.Planets)
+
+	res, err = service.Export(context.Background(), failingWriter{}, services.FormatJSON, services.SearchFilter{}, nil)
+	require.NotNil(t, err)
+	require.False(t, res.Written)
+
+	//the beginning of an empty file was already sent when its end failed
+	res, err = service.Export(context.Background(), &closingWriter{open: 1}, services.FormatJSON, services.SearchFilter{Name: "Naboo"}, nil)
+	require.NotNil(t, err)
+	require.Equal(t, 0, res.Planets)
+	require.True(t, res.Written)
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	// DefaultMaxImportSize is the size, in bytes, of the largest file Import
+	// takes by default
+	DefaultMaxImportSize = 10 << 20
+	// importBatchSize is how many rows Import creates at once
+	importBatchSize = 100
+	// maxImportLineSize is the size, in bytes, of the longest NDJSON line
+	maxImportLineSize = 16 << 10
+	// maxImportErrors is how many rows the response of Import reports
+	maxImportErrors = 100
+)
+
+// ErrInvalidImport is returned when the file sent to Import can't be read
+var ErrInvalidImport = errors.New("invalid import file")
+
+// ImportColumns are the CSV columns Import maps to planet fields, in any
+// order and case. Other columns are ignored.
+var ImportColumns = []string{"name", "climate", "terrain"}
+
+// ImportError reports a row that was not created, or would not be on a dry run
+type ImportError struct {
+	Row        int               `json:"row"`
+	Status     string            `json:"status"`
+	Errors     map[string]string `json:"errors,omitempty"`
+	ExistingID string            `json:"existingId,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+type ImportResponse struct {
+	DryRun bool `json:"dryRun"`
+	Rows   int  `json:"rows"`
+	// Created counts, on a dry run, the rows that would be created
+	Created   int `json:"created"`
+	Invalid   int `json:"invalid"`
+	Duplicate int `json:"duplicate"`
+	Failed    int `json:"failed"`
+	// Errors are the first rows, up to maxImportErrors, that were not created
+	Errors []ImportError `json:"errors"`
+	// Truncated counts the rows left out of Errors
+	Truncated int `json:"truncated"`
+}
+
+// importRow is a row of an import file, numbered from 1, holding either its
+// planet or the error that kept it from being read
+type importRow struct {
+	Number int
+	Planet models.Planet
+	Err    error
+}
+
+// rowReader reads one row at a time from an import file
+type rowReader interface {
+	// next returns io.EOF after the last row, and any other error when the
+	// file can't be read any further
+	next() (importRow, error)
+}
+
+// Import creates the planets of a CSV or NDJSON file, read as a stream and
+// created in batches, reporting the rows that could not be created. On a dry
+// run the rows are only checked, names included.
+//
+// The batches already created are kept when the import stops halfway, the
+// error being an ErrImportIncomplete telling how many planets were created.
+func (client *PlanetService) Import(ctx context.Context, file io.Reader, format string, dryRun bool) (*ImportResponse, error) {
+	if client.MaxImportSize > 0 {
+		file = &limitedFile{reader: file, max: client.MaxImportSize}
+	}
+
+	rows, err := newRowReader(file, format)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ImportResponse{DryRun: dryRun, Errors: []ImportError{}}
+	batch := []models.Planet{}
+	batchRows := []int{}
+	//names of the rows checked on a dry run, lowercased
+	names := map[string]bool{}
+
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, response.incomplete(readError(err))
+		}
+
+		response.Rows++
+
+		if row.Err != nil {
+			response.report(ImportError{Row: row.Number, Status: BulkInvalid, Errors: fieldErrors(row.Err, "row")})
+			continue
+		}
+
+		if err := validate(&row.Planet); err != nil {
+			response.report(ImportError{Row: row.Number, Status: BulkInvalid, Errors: fieldErrors(err, "row")})
+			continue
+		}
+
+		if dryRun {
+			response.report(client.checkName(ctx, row.Planet, row.Number, names))
+			continue
+		}
+
+		batch = append(batch, newPlanet(row.Planet))
+		batchRows = append(batchRows, row.Number)
+
+		if len(batch) == importBatchSize {
+			if err := client.importBatch(ctx, response, batch, batchRows); err != nil {
+				return nil, response.incomplete(err)
+			}
+			batch, batchRows = []models.Planet{}, []int{}
+		}
+	}
+
+	if err := client.importBatch(ctx, response, batch, batchRows); err != nil {
+		return nil, response.incomplete(err)
+	}
+
+	response.sortErrors()
+
+	return response, nil
+}
+
+func (client *PlanetService) importBatch(ctx context.Context, response *ImportResponse, batch []models.Planet, rows []int) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Bulk)
+	defer cancel()
+
+	results, err := client.createAll(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	for j, result := range results {
+		response.report(ImportError{
+			Row:        rows[j],
+			Status:     result.Status,
+			ExistingID: result.ExistingID,
+			Error:      result.Error,
+		})
+	}
+
+	return nil
+}
+
+// checkName tells whether a valid row of a dry run would be created, or its
+// name is taken, by a stored planet or by a previous row
+func (client *PlanetService) checkName(ctx context.Context, planet models.Planet, row int, names map[string]bool) ImportError {
+	name := strings.ToLower(planet.Name)
+	conflict := &ErrConflict{Name: planet.Name}
+
+	if names[name] {
+		return ImportError{Row: row, Status: BulkDuplicate, Error: conflict.Error()}
+	}
+	names[name] = true
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	existing, err := client.Repository.FindByName(ctx, planet.Name)
+	if err == nil {
+		conflict.Trashed = existing.DeletedAt != nil
+		return ImportError{Row: row, Status: BulkDuplicate, ExistingID: existing.ID.Hex(), Error: conflict.Error()}
+	}
+
+	if err != mongo.ErrNoDocuments {
+		log.Printf("import of planet %q: %v", planet.Name, err)
+		return ImportError{Row: row, Status: BulkFailed, Error: errStorageUnavailable}
+	}
+
+	return ImportError{Row: row, Status: BulkCreated}
+}
+
+// report counts the outcome of a row, keeping it when it was not created
+func (response *ImportResponse) report(result ImportError) {
+	switch result.Status {
+	case BulkCreated:
+		response.Created++
+		return
+	case BulkInvalid:
+		response.Invalid++
+	case BulkDuplicate:
+		response.Duplicate++
+	case BulkFailed:
+		response.Failed++
+	}
+
+	response.Errors = append(response.Errors, result)
+	if len(response.Errors) > maxImportErrors {
+		response.sortErrors()
+		response.Errors = response.Errors[:maxImportErrors]
+		response.Truncated++
+	}
+}
+
+// sortErrors sorts the errors by row, as rows failing on creation are only
+// reported once their batch is done
+func (response *ImportResponse) sortErrors() {
+	sort.SliceStable(response.Errors, func(i, j int) bool {
+		return response.Errors[i].Row < response.Errors[j].Row
+	})
+}
+
+// incomplete is the error of an import stopping on err, telling how many
+// planets were created before it stopped, if any
+func (response *ImportResponse) incomplete(err error) error {
+	if response.DryRun || response.Created == 0 {
+		return err
+	}
+
+	return &ErrImportIncomplete{Created: response.Created, Err: err}
+}
+
+// readError is the error of a file that can't be read any further, an
+// ErrInvalidImport unless the file is larger than allowed
+func readError(err error) error {
+	var tooLarge *ErrImportTooLarge
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %v", ErrInvalidImport, err)
+}
+
+// limitedFile reads a file of up to max bytes, failing with
+// ErrImportTooLarge on larger ones
+type limitedFile struct {
+	reader    io.Reader
+	max, read int64
+}
+
+func (file *limitedFile) Read(p []byte) (int, error) {
+	if file.read > file.max {
+		return 0, &ErrImportTooLarge{Max: file.max}
+	}
+
+	//reading a byte past max tells the file is larger
+	if left := file.max - file.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := file.reader.Read(p)
+	file.read += int64(n)
+
+	if file.read > file.max {
+		return n - 1, &ErrImportTooLarge{Max: file.max}
+	}
+
+	return n, err
+}
+
+func newRowReader(file io.Reader, format string) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVRows(file)
+	case FormatNDJSON:
+		return newNDJSONRows(file), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown format %v", ErrInvalidImport, format)
+}
+
+// csvRows reads the planets of a CSV file whose first row names its columns.
+// Rows are numbered as on a spreadsheet, the header being row 1.
+type csvRows struct {
+	reader  *csv.Reader
+	columns map[string]int
+	row     int
+}
+
+func newCSVRows(file io.Reader) (*csvRows, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidImport)
+	}
+
+	if err != nil {
+		return nil, readError(err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		//spreadsheets may start the file with a byte order mark
+		column = strings.TrimPrefix(column, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	for _, column := range ImportColumns {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("%w: missing column %v", ErrInvalidImport, column)
+		}
+	}
+
+	return &csvRows{reader: reader, columns: columns, row: 1}, nil
+}
+
+func (rows *csvRows) next() (importRow, error) {
+	record, err := rows.reader.Read()
+	if err == io.EOF {
+		return importRow{}, io.EOF
+	}
+
+	rows.row++
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{Number: rows.row, Err: parseErr.Err}, nil
+	}
+
+	if err != nil {
+		return importRow{}, err
+	}
+
+	planet := models.Planet{
+		Name:    rows.field(record, "name"),
+		Climate: rows.field(record, "climate"),
+		Terrain: rows.field(record, "terrain"),
+	}
+
+	return importRow{Number: rows.row, Planet: planet}, nil
+}
+
+// field is the trimmed value of a column, empty on rows missing it
+func (rows *csvRows) field(record []string, column string) string {
+	i := rows.columns[column]
+	if i >= len(record) {
+		return ""
+	}
+
+	return strings.TrimSpace(record[i])
+}
+
+// ndjsonRows reads a planet from each line of an NDJSON file, skipping blank
+// lines. Rows are numbered after their line.
+type ndjsonRows struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONRows(file io.Reader) *ndjsonRows {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLineSize)
+
+	return &ndjsonRows{scanner: scanner}
+}
+
+func (rows *ndjsonRows) next() (importRow, error) {
+	for rows.scanner.Scan() {
+		rows.line++
+
+		line := bytes.TrimSpace(rows.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		row := importRow{Number: rows.line}
+		row.Planet, row.Err = models.DecodePlanet(line)
+
+		return row, nil
+	}
+
+	err := rows.scanner.Err()
+	if err == bufio.ErrTooLong {
+		return importRow{}, fmt.Errorf("line %v is longer than %v bytes", rows.line+1, maxImportLineSize)
+	}
+
+	if err != nil {
+		return importRow{}, err
+	}
+
+	return importRow{}, io.EOF
+}
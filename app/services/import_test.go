@@ -0,0 +1,163 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCSV(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+	hoth, _ := service.Create(context.Background(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	file := "\ufeffTerrain,Name,notes,CLIMATE\n" +
+		"desert,Tatooine,home,arid\n" +
+		"swamp,Dagobah,,\n" +
+		"tundra,hoth,,frozen\n" +
+		"\"grass,Alderaan,,temperate\n"
+
+	res, err := service.Import(context.Background(), strings.NewReader(file), services.FormatCSV, false)
+
+	require.Nil(t, err)
+	require.False(t, res.DryRun)
+	require.Equal(t, 4, res.Rows)
+	require.Equal(t, 1, res.Created)
+	require.Equal(t, 2, res.Invalid)
+	require.Equal(t, 1, res.Duplicate)
+	require.Len(t, res.Errors, 3)
+
+	require.Equal(t, 3, res.Errors[0].Row)
+	require.Contains(t, res.Errors[0].Errors, "climate")
+
+	require.Equal(t, 4, res.Errors[1].Row)
+	require.Equal(t, services.BulkDuplicate, res.Errors[1].Status)
+	require.Equal(t, hoth.ID.Hex(), res.Errors[1].ExistingID)
+
+	require.Equal(t, 5, res.Errors[2].Row)
+	require.Contains(t, res.Errors[2].Errors, "row")
+
+	planet, err := service.Repository.FindByName(context.Background(), "tatooine")
+	require.Nil(t, err)
+	require.Equal(t, "arid", planet.Climate)
+	require.Equal(t, 5, planet.Appearances)
+}
+
+func TestImportNDJSONDryRun(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	file := `{"name": "Tatooine", "climate": "arid", "terrain": "desert"}
+
+{"name": "TATOOINE", "climate": "arid", "terrain": "desert"}
+{"name": "Dagobah", "climate": "murky"
+{"name": "Naboo", "climate": "temperate", "terrain": "grassy hills"}`
+
+	res, err := service.Import(context.Background(), strings.NewReader(file), services.FormatNDJSON, true)
+
+	require.Nil(t, err)
+	require.True(t, res.DryRun)
+	require.Equal(t, 4, res.Rows)
+	require.Equal(t, 2, res.Created)
+	require.Equal(t, 1, res.Duplicate)
+	require.Equal(t, 1, res.Invalid)
+	require.Equal(t, 3, res.Errors[0].Row)
+	require.Equal(t, 4, res.Errors[1].Row)
+
+	//nothing is created on a dry run
+	search, _ := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{})
+	require.Equal(t, int64(0), search.Total)
+}
+
+func TestImportInBatches(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+
+	var file strings.Builder
+	file.WriteString("name,climate,terrain\n")
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(&file, "Planet %v,arid,desert\n", i)
+	}
+
+	res, err := service.Import(context.Background(), strings.NewReader(file.String()), services.FormatCSV, false)
+
+	require.Nil(t, err)
+	require.Equal(t, 250, res.Rows)
+	require.Equal(t, 250, res.Created)
+	require.Empty(t, res.Errors)
+}
+
+func TestImportInvalidFile(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	_, err := service.Import(context.Background(), strings.NewReader("name,climate\nTatooine,arid\n"), services.FormatCSV, false)
+	require.ErrorIs(t, err, services.ErrInvalidImport)
+
+	_, err = service.Import(context.Background(), strings.NewReader(""), services.FormatCSV, false)
+	require.ErrorIs(t, err, services.ErrInvalidImport)
+}
+
+func TestImportLimits(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+	service.MaxImportSize = 64
+
+	_, err := service.Import(context.Background(), strings.NewReader("name,climate,terrain\n"+strings.Repeat("Tatooine,arid,desert\n", 3)), services.FormatCSV, true)
+	var tooLarge *services.ErrImportTooLarge
+	require.True(t, errors.As(err, &tooLarge))
+	require.Equal(t, int64(64), tooLarge.Max)
+
+	//a file within the limit is taken
+	_, err = service.Import(context.Background(), strings.NewReader("name,climate,terrain\n"+strings.Repeat("Tatooine,arid,desert\n", 2)), services.FormatCSV, true)
+	require.Nil(t, err)
+
+	service.MaxImportSize = services.DefaultMaxImportSize
+
+	line := `{"name": "` + strings.Repeat("a", 20<<10) + `"}`
+	_, err = service.Import(context.Background(), strings.NewReader("{}\n"+line), services.FormatNDJSON, true)
+	require.ErrorIs(t, err, services.ErrInvalidImport)
+	require.Contains(t, err.Error(), "line 2")
+
+	res, err := service.Import(context.Background(), strings.NewReader("name,climate,terrain\n"+strings.Repeat("Tatooine,,\n", 150)), services.FormatCSV, true)
+	require.Nil(t, err)
+	require.Equal(t, 150, res.Invalid)
+	require.Len(t, res.Errors, 100)
+	require.Equal(t, 50, res.Truncated)
+	require.Equal(t, 2, res.Errors[0].Row)
+	require.Equal(t, 101, res.Errors[99].Row)
+}
+
+// brokenUpload is an upload cut short after its first bytes were sent
+type brokenUpload struct{}
+
+func (brokenUpload) Read(p []byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestImportStoppingHalfwayKeepsItsBatches(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+
+	var file strings.Builder
+	file.WriteString("name,climate,terrain\n")
+	for i := 0; i < 150; i++ {
+		fmt.Fprintf(&file, "Planet %v,arid,desert\n", i)
+	}
+
+	_, err := service.Import(context.Background(), io.MultiReader(strings.NewReader(file.String()), brokenUpload{}), services.FormatCSV, false)
+
+	var incomplete *services.ErrImportIncomplete
+	require.True(t, errors.As(err, &incomplete))
+	require.Equal(t, 100, incomplete.Created)
+	require.ErrorIs(t, err, services.ErrInvalidImport)
+
+	search, _ := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{})
+	require.Equal(t, int64(100), search.Total)
+
+	//nothing was created before the file broke on a dry run
+	_, err = service.Import(context.Background(), io.MultiReader(strings.NewReader(file.String()), brokenUpload{}), services.FormatCSV, true)
+	require.False(t, errors.As(err, &incomplete))
+	require.ErrorIs(t, err, services.ErrInvalidImport)
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var errDuplicateKey = mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error"}}}
+
+// MemoryPlanetRepository keeps planets in process memory, in insertion order,
+// so the API can run without a MongoDB instance.
+type MemoryPlanetRepository struct {
+	mu      sync.RWMutex
+	planets map[primitive.ObjectID]models.Planet
+	order   []primitive.ObjectID
+}
+
+func NewMemoryPlanetRepository() *MemoryPlanetRepository {
+	return &MemoryPlanetRepository{
+		planets: map[primitive.ObjectID]models.Planet{},
+	}
+}
+
+func (repo *MemoryPlanetRepository) Insert(ctx context.Context, planet models.Planet) error {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if _, ok := repo.planets[planet.ID]; ok || repo.nameTaken(planet) {
+		return errDuplicateKey
+	}
+
+	repo.planets[planet.ID] = storedPlanet(planet)
+	repo.order = append(repo.order, planet.ID)
+
+	return nil
+}
+
+func (repo *MemoryPlanetRepository) InsertMany(ctx context.Context, planets []models.Planet) (map[int]error, error) {
+	failed := map[int]error{}
+
+	for i, planet := range planets {
+		if err := repo.Insert(ctx, planet); err != nil {
+			failed[i] = err
+		}
+	}
+
+	return failed, nil
+}
+
+func (repo *MemoryPlanetRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	planet, ok := repo.planets[id]
+	if !ok || planet.DeletedAt != nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return &planet, nil
+}
+
+func (repo *MemoryPlanetRepository) FindByName(ctx context.Context, name string) (*models.Planet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if strings.EqualFold(planet.Name, name) {
+			return &planet, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (repo *MemoryPlanetRepository) FindInTrash(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	planet, ok := repo.planets[id]
+	if !ok || planet.DeletedAt == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return &planet, nil
+}
+
+func (repo *MemoryPlanetRepository) Replace(ctx context.Context, planet models.Planet) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	if stored, ok := repo.planets[planet.ID]; !ok || stored.DeletedAt != nil || stored.Version != planet.Version {
+		return false, nil
+	}
+
+	if repo.nameTaken(planet) {
+		return false, errDuplicateKey
+	}
+
+	planet.Version++
+	repo.planets[planet.ID] = storedPlanet(planet)
+
+	return true, nil
+}
+
+func (repo *MemoryPlanetRepository) UpdateAppearances(ctx context.Context, planet models.Planet) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.planets[planet.ID]
+	if !ok || stored.DeletedAt != nil || stored.Version != planet.Version {
+		return false, nil
+	}
+
+	stored.Appearances = planet.Appearances
+	stored.AppearancesUpdatedAt = planet.AppearancesUpdatedAt
+	stored.LookupStatus = planet.LookupStatus
+	stored.Swapi = planet.Swapi
+	stored.Version++
+	repo.planets[planet.ID] = storedPlanet(stored)
+
+	return true, nil
+}
+
+func (repo *MemoryPlanetRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, version int64, deletedAt time.Time) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.planets[id]
+	if !ok || stored.DeletedAt != nil || !hasVersion(stored, version) {
+		return false, nil
+	}
+
+	stored.DeletedAt = &deletedAt
+	stored.Version++
+	repo.planets[id] = storedPlanet(stored)
+
+	return true, nil
+}
+
+func (repo *MemoryPlanetRepository) Restore(ctx context.Context, id primitive.ObjectID, version int64) (bool, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	stored, ok := repo.planets[id]
+	if !ok || stored.DeletedAt == nil || !hasVersion(stored, version) {
+		return false, nil
+	}
+
+	stored.DeletedAt = nil
+	stored.Version++
+	repo.planets[id] = stored
+
+	return true, nil
+}
+
+func (repo *MemoryPlanetRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	var purged int64
+	order := []primitive.ObjectID{}
+
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if planet.DeletedAt != nil && planet.DeletedAt.Before(deletedBefore) {
+			delete(repo.planets, id)
+			purged++
+			continue
+		}
+
+		order = append(order, id)
+	}
+	repo.order = order
+
+	return purged, nil
+}
+
+func (repo *MemoryPlanetRepository) Search(ctx context.Context, filter SearchFilter, pagination Pagination) (*SearchResponse, error) {
+	matches, err := filter.Matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	planets := []models.Planet{}
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if matches(planet) {
+			planets = append(planets, planet)
+		}
+	}
+	repo.mu.RUnlock()
+
+	pagination.sortPlanets(planets)
+
+	return paginate(planets, pagination.Page, pagination.PerPage), nil
+}
+
+func (repo *MemoryPlanetRepository) SearchAfter(ctx context.Context, filter SearchFilter, cursor *Cursor, limit int64) ([]models.Planet, error) {
+	matches, err := filter.Matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	repo.mu.RLock()
+	planets := []models.Planet{}
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if matches(planet) && (cursor == nil || cursor.after(planet)) {
+			planets = append(planets, planet)
+		}
+	}
+	repo.mu.RUnlock()
+
+	sort.SliceStable(planets, func(i, j int) bool {
+		return cursorOf(planets[i]).after(planets[j])
+	})
+
+	if int64(len(planets)) > limit {
+		planets = planets[:limit]
+	}
+
+	return planets, nil
+}
+
+func (repo *MemoryPlanetRepository) ForEach(ctx context.Context, filter SearchFilter, sort []SortField, fn func(models.Planet) error) error {
+	matches, err := filter.Matcher()
+	if err != nil {
+		return err
+	}
+
+	repo.mu.RLock()
+	planets := []models.Planet{}
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if matches(planet) {
+			planets = append(planets, planet)
+		}
+	}
+	repo.mu.RUnlock()
+
+	Pagination{Sort: sort}.sortPlanets(planets)
+
+	for _, planet := range planets {
+		if err := fn(planet); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (repo *MemoryPlanetRepository) FindStale(ctx context.Context, updatedBefore time.Time, limit int64) ([]models.Planet, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	planets := []models.Planet{}
+	for _, id := range repo.order {
+		planet := repo.planets[id]
+		if planet.DeletedAt != nil {
+			continue
+		}
+
+		if planet.LookupStatus == string(swapi.StatusUpstreamError) || planet.AppearancesUpdatedAt.Before(updatedBefore) {
+			planets = append(planets, planet)
+		}
+	}
+
+	sort.SliceStable(planets, func(i, j int) bool {
+		return planets[i].AppearancesUpdatedAt.Before(planets[j].AppearancesUpdatedAt)
+	})
+
+	if int64(len(planets)) > limit {
+		planets = planets[:limit]
+	}
+
+	return planets, nil
+}
+
+// nameTaken tells whether another planet has the same name, mirroring the
+// unique index on mongo
+func (repo *MemoryPlanetRepository) nameTaken(planet models.Planet) bool {
+	for id, stored := range repo.planets {
+		if id != planet.ID && strings.EqualFold(stored.Name, planet.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasVersion tells whether planet is at the given version, any version
+// matching 0
+func hasVersion(planet models.Planet, version int64) bool {
+	return version == 0 || planet.Version == version
+}
+
+// Clear removes every stored planet
+func (repo *MemoryPlanetRepository) Clear() {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.planets = map[primitive.ObjectID]models.Planet{}
+	repo.order = nil
+}
+
+// storedPlanet mimics a round trip through mongo, which keeps dates in UTC
+// with millisecond precision
+func storedPlanet(planet models.Planet) models.Planet {
+	planet.CreatedAt = planet.CreatedAt.Truncate(time.Millisecond).UTC()
+	planet.AppearancesUpdatedAt = planet.AppearancesUpdatedAt.Truncate(time.Millisecond).UTC()
+
+	if planet.Swapi != nil {
+		attributes := *planet.Swapi
+		planet.Swapi = &attributes
+	}
+
+	if planet.DeletedAt != nil {
+		deletedAt := planet.DeletedAt.Truncate(time.Millisecond).UTC()
+		planet.DeletedAt = &deletedAt
+	}
+
+	return planet
+}
+
+// paginate slices planets the same way mongopagination does, so both
+// repositories return identical SearchResponse metadata.
+func paginate(planets []models.Planet, page int64, perPage int64) *SearchResponse {
+	if page < 1 {
+		page = 1
+	}
+	if perPage < 1 {
+		perPage = 10
+	}
+
+	total := int64(len(planets))
+	result := SearchResponse{
+		Page:      page,
+		PerPage:   perPage,
+		Total:     total,
+		TotalPage: int64(math.Ceil(float64(total) / float64(perPage))),
+		Result:    []models.Planet{},
+	}
+
+	if total > 0 {
+		if page > 1 {
+			result.Prev = page - 1
+		}
+		if page < result.TotalPage {
+			result.Next = page + 1
+		}
+	}
+
+	start := (page - 1) * perPage
+	if start < total {
+		end := start + perPage
+		if end > total {
+			end = total
+		}
+		result.Result = planets[start:end]
+	}
+
+	return &result
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryRevisionRepository keeps the history of the planets in process memory
+type MemoryRevisionRepository struct {
+	mu        sync.RWMutex
+	revisions map[primitive.ObjectID][]models.Revision
+}
+
+func NewMemoryRevisionRepository() *MemoryRevisionRepository {
+	return &MemoryRevisionRepository{
+		revisions: map[primitive.ObjectID][]models.Revision{},
+	}
+}
+
+func (repo *MemoryRevisionRepository) Append(ctx context.Context, revision models.Revision) (int, error) {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	revision.ID = primitive.NewObjectID()
+	revision.Revision = len(repo.revisions[revision.PlanetID]) + 1
+	revision.Planet = storedPlanet(revision.Planet)
+	revision.CreatedAt = revision.CreatedAt.Truncate(time.Millisecond).UTC()
+	repo.revisions[revision.PlanetID] = append(repo.revisions[revision.PlanetID], revision)
+
+	return revision.Revision, nil
+}
+
+func (repo *MemoryRevisionRepository) Last(ctx context.Context, planetID primitive.ObjectID) (*models.Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	revisions := repo.revisions[planetID]
+	if len(revisions) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	revision := revisions[len(revisions)-1]
+
+	return &revision, nil
+}
+
+func (repo *MemoryRevisionRepository) Find(ctx context.Context, planetID primitive.ObjectID, number int) (*models.Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	revisions := repo.revisions[planetID]
+	if number < 1 || number > len(revisions) {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	revision := revisions[number-1]
+
+	return &revision, nil
+}
+
+func (repo *MemoryRevisionRepository) History(ctx context.Context, planetID primitive.ObjectID) ([]models.Revision, error) {
+	repo.mu.RLock()
+	defer repo.mu.RUnlock()
+
+	revisions := append([]models.Revision{}, repo.revisions[planetID]...)
+
+	return revisions, nil
+}
+
+// Clear removes every stored revision
+func (repo *MemoryRevisionRepository) Clear() {
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+
+	repo.revisions = map[primitive.ObjectID][]models.Revision{}
+}
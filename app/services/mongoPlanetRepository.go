@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	mongopagination "github.com/gobeam/mongo-go-pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoPlanetRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewMongoPlanetRepository(collection *mongo.Collection) *MongoPlanetRepository {
+	return &MongoPlanetRepository{
+		Collection: collection,
+	}
+}
+
+func (repo *MongoPlanetRepository) Insert(ctx context.Context, planet models.Planet) error {
+	_, err := repo.Collection.InsertOne(ctx, planet)
+	return err
+}
+
+func (repo *MongoPlanetRepository) InsertMany(ctx context.Context, planets []models.Planet) (map[int]error, error) {
+	failed := map[int]error{}
+	if len(planets) == 0 {
+		return failed, nil
+	}
+
+	documents := make([]interface{}, len(planets))
+	for i, planet := range planets {
+		documents[i] = planet
+	}
+
+	_, err := repo.Collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		//each error is wrapped so mongo.IsDuplicateKeyError still applies to it
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[writeErr.Index] = mongo.WriteException{WriteErrors: mongo.WriteErrors{writeErr.WriteError}}
+		}
+
+		return failed, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return failed, nil
+}
+
+func (repo *MongoPlanetRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	planet := models.Planet{}
+
+	err := repo.Collection.FindOne(ctx, active(bson.M{"_id": id})).Decode(&planet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &planet, nil
+}
+
+func (repo *MongoPlanetRepository) FindByName(ctx context.Context, name string) (*models.Planet, error) {
+	planet := models.Planet{}
+
+	err := repo.Collection.FindOne(ctx, bson.M{"name": name}, options.FindOne().SetCollation(database.CaseInsensitive)).Decode(&planet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &planet, nil
+}
+
+func (repo *MongoPlanetRepository) FindInTrash(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	planet := models.Planet{}
+
+	err := repo.Collection.FindOne(ctx, bson.M{"_id": id, "deletedAt": bson.M{"$ne": nil}}).Decode(&planet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &planet, nil
+}
+
+func (repo *MongoPlanetRepository) Replace(ctx context.Context, planet models.Planet) (bool, error) {
+	filter := active(bson.M{"_id": planet.ID, "version": planet.Version})
+	planet.Version++
+
+	res, err := repo.Collection.ReplaceOne(ctx, filter, planet)
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (repo *MongoPlanetRepository) UpdateAppearances(ctx context.Context, planet models.Planet) (bool, error) {
+	update := bson.M{"$set": bson.M{
+		"appearances":          planet.Appearances,
+		"appearancesUpdatedAt": planet.AppearancesUpdatedAt,
+		"lookupStatus":         planet.LookupStatus,
+		"swapi":                planet.Swapi,
+	}, "$inc": bson.M{"version": 1}}
+
+	res, err := repo.Collection.UpdateOne(ctx, active(bson.M{"_id": planet.ID, "version": planet.Version}), update)
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (repo *MongoPlanetRepository) SoftDelete(ctx context.Context, id primitive.ObjectID, version int64, deletedAt time.Time) (bool, error) {
+	update := bson.M{"$set": bson.M{"deletedAt": deletedAt}, "$inc": bson.M{"version": 1}}
+
+	res, err := repo.Collection.UpdateOne(ctx, withVersion(active(bson.M{"_id": id}), version), update)
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (repo *MongoPlanetRepository) Restore(ctx context.Context, id primitive.ObjectID, version int64) (bool, error) {
+	filter := withVersion(bson.M{"_id": id, "deletedAt": bson.M{"$ne": nil}}, version)
+	update := bson.M{"$set": bson.M{"deletedAt": nil}, "$inc": bson.M{"version": 1}}
+
+	res, err := repo.Collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+
+	return res.MatchedCount > 0, nil
+}
+
+func (repo *MongoPlanetRepository) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := repo.Collection.DeleteMany(ctx, bson.M{"deletedAt": bson.M{"$ne": nil, "$lt": deletedBefore}})
+	if err != nil {
+		return 0, err
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (repo *MongoPlanetRepository) Search(ctx context.Context, filter SearchFilter, pagination Pagination) (*SearchResponse, error) {
+	planets := []models.Planet{}
+
+	query := mongopagination.New(repo.Collection).Context(ctx).Limit(pagination.PerPage).Page(pagination.Page).Filter(filter.Query())
+	for _, field := range pagination.sortQuery() {
+		query = query.Sort(field.Key, field.Value)
+	}
+
+	paginatedData, err := query.Decode(&planets).Find()
+	if err != nil {
+		return nil, err
+	}
+
+	result := SearchResponse{
+		Page:      paginatedData.Pagination.Page,
+		Next:      paginatedData.Pagination.Next,
+		Prev:      paginatedData.Pagination.Prev,
+		PerPage:   paginatedData.Pagination.PerPage,
+		Total:     paginatedData.Pagination.Total,
+		TotalPage: paginatedData.Pagination.TotalPage,
+		Result:    planets,
+	}
+
+	return &result, nil
+}
+
+func (repo *MongoPlanetRepository) SearchAfter(ctx context.Context, filter SearchFilter, cursor *Cursor, limit int64) ([]models.Planet, error) {
+	planets := []models.Planet{}
+
+	query := filter.Query()
+	if cursor != nil {
+		query = bson.M{"$and": []bson.M{query, cursor.query()}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}).SetLimit(limit)
+
+	res, err := repo.Collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = res.All(ctx, &planets)
+	if err != nil {
+		return nil, err
+	}
+
+	return planets, nil
+}
+
+func (repo *MongoPlanetRepository) ForEach(ctx context.Context, filter SearchFilter, sort []SortField, fn func(models.Planet) error) error {
+	opts := options.Find()
+	if query := (Pagination{Sort: sort}).sortQuery(); len(query) > 0 {
+		opts.SetSort(query)
+	}
+
+	cursor, err := repo.Collection.Find(ctx, filter.Query(), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		planet := models.Planet{}
+		if err := cursor.Decode(&planet); err != nil {
+			return err
+		}
+
+		if err := fn(planet); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (repo *MongoPlanetRepository) FindStale(ctx context.Context, updatedBefore time.Time, limit int64) ([]models.Planet, error) {
+	planets := []models.Planet{}
+	filter := active(bson.M{"$or": []bson.M{
+		{"lookupStatus": swapi.StatusUpstreamError},
+		{"appearancesUpdatedAt": bson.M{"$lt": updatedBefore}},
+		{"appearancesUpdatedAt": bson.M{"$exists": false}},
+	}})
+
+	cursor, err := repo.Collection.Find(ctx, filter, options.Find().SetSort(bson.M{"appearancesUpdatedAt": 1}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &planets)
+	if err != nil {
+		return nil, err
+	}
+
+	return planets, nil
+}
+
+// active restricts filter to the planets out of the trash, a null deletedAt
+// also matching the documents stored before it existed
+func active(filter bson.M) bson.M {
+	filter["deletedAt"] = nil
+	return filter
+}
+
+// withVersion restricts filter to the given version of the planet, unless it is 0
+func withVersion(filter bson.M, version int64) bson.M {
+	if version != 0 {
+		filter["version"] = version
+	}
+
+	return filter
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// appendAttempts bounds the retries when concurrent changes of a planet race
+// for the same revision number
+const appendAttempts = 5
+
+type MongoRevisionRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewMongoRevisionRepository(collection *mongo.Collection) *MongoRevisionRepository {
+	return &MongoRevisionRepository{
+		Collection: collection,
+	}
+}
+
+func (repo *MongoRevisionRepository) Append(ctx context.Context, revision models.Revision) (int, error) {
+	var err error
+
+	for attempt := 0; attempt < appendAttempts; attempt++ {
+		revision.Revision = 1
+
+		last, lastErr := repo.Last(ctx, revision.PlanetID)
+		if lastErr == nil {
+			revision.Revision = last.Revision + 1
+		} else if lastErr != mongo.ErrNoDocuments {
+			return 0, lastErr
+		}
+
+		//the unique index on planetId and revision rejects a number already taken
+		revision.ID = primitive.NewObjectID()
+		_, err = repo.Collection.InsertOne(ctx, revision)
+		if !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return revision.Revision, nil
+}
+
+func (repo *MongoRevisionRepository) Last(ctx context.Context, planetID primitive.ObjectID) (*models.Revision, error) {
+	revision := models.Revision{}
+	opts := options.FindOne().SetSort(bson.M{"revision": -1})
+
+	err := repo.Collection.FindOne(ctx, bson.M{"planetId": planetID}, opts).Decode(&revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (repo *MongoRevisionRepository) Find(ctx context.Context, planetID primitive.ObjectID, number int) (*models.Revision, error) {
+	revision := models.Revision{}
+
+	err := repo.Collection.FindOne(ctx, bson.M{"planetId": planetID, "revision": number}).Decode(&revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (repo *MongoRevisionRepository) History(ctx context.Context, planetID primitive.ObjectID) ([]models.Revision, error) {
+	revisions := []models.Revision{}
+
+	cursor, err := repo.Collection.Find(ctx, bson.M{"planetId": planetID}, options.Find().SetSort(bson.M{"revision": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	err = cursor.All(ctx, &revisions)
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
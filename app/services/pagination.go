@@ -0,0 +1,102 @@
+package services
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	DefaultPageSize    = 30
+	DefaultMaxPageSize = 100
+)
+
+// SortableFields are the planet fields Search can be ordered by
+var SortableFields = []string{"name", "climate", "terrain", "appearances", "createdAt"}
+
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// Pagination selects which page of the results Search returns and how the
+// results are ordered. Ties, as well as an empty Sort, follow insertion order.
+type Pagination struct {
+	Page    int64
+	PerPage int64
+	Sort    []SortField
+}
+
+func IsSortable(field string) bool {
+	for _, sortable := range SortableFields {
+		if field == sortable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortQuery builds the mongo sort document, using _id as the last key so pages
+// never overlap when sort values are equal
+func (pagination Pagination) sortQuery() bson.D {
+	query := bson.D{}
+
+	for _, field := range pagination.Sort {
+		order := 1
+		if field.Descending {
+			order = -1
+		}
+		query = append(query, bson.E{Key: field.Field, Value: order})
+	}
+
+	if len(query) > 0 {
+		query = append(query, bson.E{Key: "_id", Value: 1})
+	}
+
+	return query
+}
+
+// sortPlanets orders planets the same way sortQuery does on mongo
+func (pagination Pagination) sortPlanets(planets []models.Planet) {
+	sort.SliceStable(planets, func(i, j int) bool {
+		for _, field := range pagination.Sort {
+			comparison := compareField(planets[i], planets[j], field.Field)
+			if comparison == 0 {
+				continue
+			}
+
+			if field.Descending {
+				return comparison > 0
+			}
+
+			return comparison < 0
+		}
+
+		return false
+	})
+}
+
+func compareField(a models.Planet, b models.Planet, field string) int {
+	switch field {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "climate":
+		return strings.Compare(a.Climate, b.Climate)
+	case "terrain":
+		return strings.Compare(a.Terrain, b.Terrain)
+	case "appearances":
+		return a.Appearances - b.Appearances
+	case "createdAt":
+		if a.CreatedAt.Before(b.CreatedAt) {
+			return -1
+		}
+		if a.CreatedAt.After(b.CreatedAt) {
+			return 1
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,65 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+)
+
+func names(planets []models.Planet) []string {
+	result := []string{}
+	for _, planet := range planets {
+		result = append(result, planet.Name)
+	}
+
+	return result
+}
+
+func TestSearchSortedByMultipleFields(t *testing.T) {
+	_, service := mockPlanet(models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+	mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	mockPlanet(models.Planet{Name: "Bespin", Climate: "Temperate", Terrain: "Gas giant"})
+	mockPlanet(models.Planet{Name: "Naboo", Climate: "Temperate", Terrain: "Swamps"})
+
+	res, err := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{Page: 1, Sort: []services.SortField{{Field: "name"}}})
+	require.Nil(t, err)
+	require.Equal(t, []string{"Bespin", "Hoth", "Naboo", "Tatooine"}, names(res.Result))
+
+	sort := []services.SortField{{Field: "appearances", Descending: true}, {Field: "name", Descending: true}}
+	res, err = service.Search(context.Background(), services.SearchFilter{}, services.Pagination{Page: 1, Sort: sort})
+	require.Nil(t, err)
+	require.Equal(t, []string{"Tatooine", "Naboo", "Hoth", "Bespin"}, names(res.Result))
+
+	//pages keep the sort order
+	res, err = service.Search(context.Background(), services.SearchFilter{}, services.Pagination{Page: 2, PerPage: 3, Sort: sort})
+	require.Nil(t, err)
+	require.Equal(t, []string{"Bespin"}, names(res.Result))
+
+	clearDatabase(repository)
+}
+
+func TestSearchPageSizeIsCapped(t *testing.T) {
+	_, service := mockPlanet(models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+	mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	mockPlanet(models.Planet{Name: "Bespin", Climate: "Temperate", Terrain: "Gas giant"})
+
+	res, err := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{})
+	require.Nil(t, err)
+	require.Equal(t, int64(services.DefaultPageSize), res.PerPage)
+	require.Equal(t, int64(1), res.Page)
+
+	capped := services.NewPlanetServiceWithRepository(repository, swapiClient)
+	capped.MaxPageSize = 2
+
+	res, err = capped.Search(context.Background(), services.SearchFilter{}, services.Pagination{Page: 1, PerPage: 50})
+	require.Nil(t, err)
+	require.Equal(t, int64(2), res.PerPage)
+	require.Equal(t, int64(2), res.TotalPage)
+	require.Equal(t, int64(2), res.Next)
+	require.Len(t, res.Result, 2)
+
+	clearDatabase(repository)
+}
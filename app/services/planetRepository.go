@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PlanetRepository is the storage used by PlanetService. FindByID and FindByName
+// must return mongo.ErrNoDocuments when the planet does not exist, and Insert
+// and Replace a duplicate key error when the name, compared case insensitively,
+// is already taken, whatever the backend.
+// UpdateAppearances only writes the fields of planet resolved from swapi.
+// Planets in the trash are hidden from every method but FindByName,
+// FindInTrash, Restore and Purge, and keep their name taken until they are purged.
+// Every write increases the version of the planet. Replace only writes while
+// the stored version is still planet.Version, as does UpdateAppearances, so
+// a lookup of the old name is not written over a renamed planet, and
+// SoftDelete and Restore while it is version, unless it is 0.
+type PlanetRepository interface {
+	Insert(ctx context.Context, planet models.Planet) error
+	// InsertMany stores every planet it can, not stopping at the first
+	// failure, and returns the errors of the others keyed by their index
+	InsertMany(ctx context.Context, planets []models.Planet) (map[int]error, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Planet, error)
+	FindByName(ctx context.Context, name string) (*models.Planet, error)
+	FindInTrash(ctx context.Context, id primitive.ObjectID) (*models.Planet, error)
+	Replace(ctx context.Context, planet models.Planet) (bool, error)
+	UpdateAppearances(ctx context.Context, planet models.Planet) (bool, error)
+	// SoftDelete moves the planet to the trash, setting its deletedAt
+	SoftDelete(ctx context.Context, id primitive.ObjectID, version int64, deletedAt time.Time) (bool, error)
+	// Restore takes the planet out of the trash
+	Restore(ctx context.Context, id primitive.ObjectID, version int64) (bool, error)
+	// Purge permanently removes the planets moved to the trash before deletedBefore
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	Search(ctx context.Context, filter SearchFilter, pagination Pagination) (*SearchResponse, error)
+	// SearchAfter returns up to limit planets matching filter in (createdAt, _id)
+	// order, starting right after cursor, or from the first one if it is nil
+	SearchAfter(ctx context.Context, filter SearchFilter, cursor *Cursor, limit int64) ([]models.Planet, error)
+	// ForEach calls fn with each planet matching filter, in the order of sort,
+	// stopping at the first error. Planets are read as they are needed, so
+	// memory use does not grow with their number.
+	ForEach(ctx context.Context, filter SearchFilter, sort []SortField, fn func(models.Planet) error) error
+	// FindStale returns up to limit planets whose swapi lookup failed or is older than updatedBefore
+	FindStale(ctx context.Context, updatedBefore time.Time, limit int64) ([]models.Planet, error)
+}
@@ -0,0 +1,424 @@
+package services_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/database"
+	"github.com/Azuos0/b2w_challenge/app/migrations"
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// repositoryTests are run against every PlanetRepository, so the memory one
+// keeps the semantics of mongo
+var repositoryTests = map[string]func(t *testing.T, repo services.PlanetRepository){
+	"FindAndSoftDelete":      testFindAndSoftDelete,
+	"RestoreAndPurge":        testRestoreAndPurge,
+	"SearchPagination":       testSearchPagination,
+	"SearchFilters":          testSearchFilters,
+	"RejectsDuplicateNames":  testRejectsDuplicateNames,
+	"InsertMany":             testInsertMany,
+	"VersionedWrites":        testVersionedWrites,
+	"SearchAfterAndForEach":  testSearchAfterAndForEach,
+	"FindStale":              testFindStale,
+	"StoresEveryPlanetField": testStoresEveryPlanetField,
+}
+
+func TestMemoryPlanetRepository(t *testing.T) {
+	for name, test := range repositoryTests {
+		t.Run(name, func(t *testing.T) {
+			test(t, services.NewMemoryPlanetRepository())
+		})
+	}
+}
+
+// TestMongoPlanetRepository runs only when MONGODB_TEST_URL points to a mongo
+// whose test database can be dropped
+func TestMongoPlanetRepository(t *testing.T) {
+	db := mongoTestDatabase(t)
+
+	for name, test := range repositoryTests {
+		t.Run(name, func(t *testing.T) {
+			require.Nil(t, db.Drop(context.Background()))
+			_, err := migrations.NewRunner(db, migrations.All).Up(context.Background())
+			require.Nil(t, err)
+
+			test(t, services.NewMongoPlanetRepository(database.GetCollection(db, "planets")))
+		})
+	}
+}
+
+// mongoTestDatabase connects to the database of MONGODB_TEST_URL, named after
+// MONGODB_TEST_DATABASE, skipping the test when it is not set
+func mongoTestDatabase(t *testing.T) *mongo.Database {
+	url := os.Getenv("MONGODB_TEST_URL")
+	if url == "" {
+		t.Skip("MONGODB_TEST_URL is not set")
+	}
+
+	name := os.Getenv("MONGODB_TEST_DATABASE")
+	if name == "" {
+		name = "swapp_test"
+	}
+
+	db, err := database.Connect(database.Settings{URL: url, Database: name})
+	require.Nil(t, err)
+	t.Cleanup(func() {
+		db.Client().Disconnect(context.Background())
+	})
+
+	return db
+}
+
+func testFindAndSoftDelete(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+
+	planet := models.Planet{ID: primitive.NewObjectID(), Name: "Tatooine", Climate: "Arid", Terrain: "Desert", Version: 1}
+	require.Nil(t, repo.Insert(ctx, planet))
+
+	found, err := repo.FindByID(ctx, planet.ID)
+	require.Nil(t, err)
+	require.Equal(t, planet.Name, found.Name)
+
+	_, err = repo.FindByID(ctx, primitive.NewObjectID())
+	require.Equal(t, mongo.ErrNoDocuments, err)
+
+	deleted, err := repo.SoftDelete(ctx, planet.ID, 0, time.Now())
+	require.Nil(t, err)
+	require.True(t, deleted)
+
+	_, err = repo.FindByID(ctx, planet.ID)
+	require.Equal(t, mongo.ErrNoDocuments, err)
+
+	trashed, err := repo.FindInTrash(ctx, planet.ID)
+	require.Nil(t, err)
+	require.NotNil(t, trashed.DeletedAt)
+	require.Equal(t, int64(2), trashed.Version)
+
+	deleted, err = repo.SoftDelete(ctx, planet.ID, 0, time.Now())
+	require.Nil(t, err)
+	require.False(t, deleted)
+}
+
+func testRestoreAndPurge(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+
+	tatooine := models.Planet{ID: primitive.NewObjectID(), Name: "Tatooine", Version: 1}
+	hoth := models.Planet{ID: primitive.NewObjectID(), Name: "Hoth", Version: 1}
+	require.Nil(t, repo.Insert(ctx, tatooine))
+	require.Nil(t, repo.Insert(ctx, hoth))
+
+	restored, err := repo.Restore(ctx, tatooine.ID, 0)
+	require.Nil(t, err)
+	require.False(t, restored)
+
+	repo.SoftDelete(ctx, tatooine.ID, 0, time.Now().Add(-time.Hour))
+	repo.SoftDelete(ctx, hoth.ID, 0, time.Now())
+
+	//the name is kept until the planet is purged
+	err = repo.Insert(ctx, models.Planet{ID: primitive.NewObjectID(), Name: "tatooine"})
+	require.True(t, mongo.IsDuplicateKeyError(err))
+
+	found, err := repo.FindByName(ctx, "TATOOINE")
+	require.Nil(t, err)
+	require.NotNil(t, found.DeletedAt)
+
+	purged, err := repo.Purge(ctx, time.Now().Add(-time.Minute))
+	require.Nil(t, err)
+	require.Equal(t, int64(1), purged)
+
+	restored, err = repo.Restore(ctx, tatooine.ID, 0)
+	require.Nil(t, err)
+	require.False(t, restored)
+
+	//restoring a stale version of the trashed planet fails
+	restored, err = repo.Restore(ctx, hoth.ID, 1)
+	require.Nil(t, err)
+	require.False(t, restored)
+
+	restored, err = repo.Restore(ctx, hoth.ID, 2)
+	require.Nil(t, err)
+	require.True(t, restored)
+
+	found, err = repo.FindByID(ctx, hoth.ID)
+	require.Nil(t, err)
+	require.Nil(t, found.DeletedAt)
+	require.Equal(t, int64(3), found.Version)
+
+	require.Nil(t, repo.Insert(ctx, models.Planet{ID: primitive.NewObjectID(), Name: "tatooine"}))
+}
+
+func testSearchPagination(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		planet := models.Planet{ID: primitive.NewObjectID(), Name: fmt.Sprintf("Planet %v", i)}
+		require.Nil(t, repo.Insert(ctx, planet))
+	}
+
+	byName := []services.SortField{{Field: "name"}}
+
+	res, err := repo.Search(ctx, services.SearchFilter{}, services.Pagination{Page: 2, PerPage: 2, Sort: byName})
+	require.Nil(t, err)
+	require.Equal(t, int64(5), res.Total)
+	require.Equal(t, int64(3), res.TotalPage)
+	require.Equal(t, int64(1), res.Prev)
+	require.Equal(t, int64(3), res.Next)
+	require.Equal(t, "Planet 2", res.Result[0].Name)
+	require.Equal(t, "Planet 3", res.Result[1].Name)
+
+	res, err = repo.Search(ctx, services.SearchFilter{}, services.Pagination{Page: 3, PerPage: 2, Sort: byName})
+	require.Nil(t, err)
+	require.Equal(t, int64(0), res.Next)
+	require.Len(t, res.Result, 1)
+
+	res, err = repo.Search(ctx, services.SearchFilter{Name: "planet 4"}, services.Pagination{Page: 1, PerPage: 2})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), res.Total)
+}
+
+func testSearchFilters(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+	created := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, planet := range []models.Planet{
+		{Name: "Tatooine", Climate: "arid", Terrain: "desert", Appearances: 5, Swapi: &models.SwapiAttributes{Population: new(int64)}},
+		{Name: "Hoth", Climate: "frozen", Terrain: "tundra, ice caves", Appearances: 1},
+		{Name: "Naboo", Climate: "temperate", Terrain: "grassy hills, swamps", Appearances: 4},
+		{Name: "Dagobah", Climate: "murky", Terrain: "swamp, jungles", Appearances: 3},
+	} {
+		planet.ID = primitive.NewObjectID()
+		planet.CreatedAt = created.AddDate(0, 0, i)
+		require.Nil(t, repo.Insert(ctx, planet))
+	}
+
+	names := func(filter services.SearchFilter) []string {
+		res, err := repo.Search(ctx, filter, services.Pagination{Page: 1, PerPage: 10, Sort: []services.SortField{{Field: "name"}}})
+		require.Nil(t, err)
+
+		names := []string{}
+		for _, planet := range res.Result {
+			names = append(names, planet.Name)
+		}
+
+		return names
+	}
+
+	after := created.AddDate(0, 0, 2).Add(-time.Minute)
+
+	require.Equal(t, []string{"Hoth", "Tatooine"}, names(services.SearchFilter{Name: "^(TAT|hot)"}))
+	require.Equal(t, []string{"Dagobah"}, names(services.SearchFilter{Terrains: []string{"Swamp"}}))
+	require.Equal(t, []string{"Hoth", "Tatooine"}, names(services.SearchFilter{Climates: []string{"arid", "frozen"}}))
+	require.Equal(t, []string{"Dagobah", "Naboo"}, names(services.SearchFilter{Appearances: services.Range{Min: float(3), Max: float(4)}}))
+	require.Equal(t, []string{"Dagobah", "Naboo"}, names(services.SearchFilter{CreatedAfter: &after}))
+	require.Equal(t, []string{"Tatooine"}, names(services.SearchFilter{Swapi: map[string]services.Range{"population": {Max: float(0)}}}))
+}
+
+func testRejectsDuplicateNames(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+
+	tatooine := models.Planet{ID: primitive.NewObjectID(), Name: "Tatooine", Version: 1}
+	hoth := models.Planet{ID: primitive.NewObjectID(), Name: "Hoth", Version: 1}
+	require.Nil(t, repo.Insert(ctx, tatooine))
+	require.Nil(t, repo.Insert(ctx, hoth))
+
+	err := repo.Insert(ctx, models.Planet{ID: primitive.NewObjectID(), Name: "TATOOINE"})
+	require.True(t, mongo.IsDuplicateKeyError(err))
+
+	hoth.Name = "tatooine"
+	_, err = repo.Replace(ctx, hoth)
+	require.True(t, mongo.IsDuplicateKeyError(err))
+
+	found, err := repo.FindByName(ctx, "tAtOoInE")
+	require.Nil(t, err)
+	require.Equal(t, tatooine.ID, found.ID)
+
+	_, err = repo.FindByName(ctx, "Naboo")
+	require.Equal(t, mongo.ErrNoDocuments, err)
+}
+
+func testInsertMany(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+	require.Nil(t, repo.Insert(ctx, models.Planet{ID: primitive.NewObjectID(), Name: "Hoth"}))
+
+	failed, err := repo.InsertMany(ctx, []models.Planet{
+		{ID: primitive.NewObjectID(), Name: "Tatooine"},
+		{ID: primitive.NewObjectID(), Name: "HOTH"},
+		{ID: primitive.NewObjectID(), Name: "tatooine"},
+		{ID: primitive.NewObjectID(), Name: "Naboo"},
+	})
+
+	//the planets after a failure are still inserted
+	require.Nil(t, err)
+	require.Len(t, failed, 2)
+	require.True(t, mongo.IsDuplicateKeyError(failed[1]))
+	require.True(t, mongo.IsDuplicateKeyError(failed[2]))
+
+	_, err = repo.FindByName(ctx, "naboo")
+	require.Nil(t, err)
+
+	failed, err = repo.InsertMany(ctx, nil)
+	require.Nil(t, err)
+	require.Empty(t, failed)
+}
+
+func testVersionedWrites(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+
+	planet := models.Planet{ID: primitive.NewObjectID(), Name: "Tatooine", Climate: "arid", Terrain: "desert", Version: 1}
+	require.Nil(t, repo.Insert(ctx, planet))
+
+	planet.Climate = "hot"
+	replaced, err := repo.Replace(ctx, planet)
+	require.Nil(t, err)
+	require.True(t, replaced)
+
+	//the same version was already written
+	replaced, err = repo.Replace(ctx, planet)
+	require.Nil(t, err)
+	require.False(t, replaced)
+
+	planet.Version = 2
+	planet.Appearances = 5
+	planet.LookupStatus = string(swapi.StatusMatched)
+	updated, err := repo.UpdateAppearances(ctx, planet)
+	require.Nil(t, err)
+	require.True(t, updated)
+
+	updated, err = repo.UpdateAppearances(ctx, planet)
+	require.Nil(t, err)
+	require.False(t, updated)
+
+	found, err := repo.FindByID(ctx, planet.ID)
+	require.Nil(t, err)
+	require.Equal(t, int64(3), found.Version)
+	require.Equal(t, "hot", found.Climate)
+	require.Equal(t, 5, found.Appearances)
+
+	deleted, err := repo.SoftDelete(ctx, planet.ID, 2, time.Now())
+	require.Nil(t, err)
+	require.False(t, deleted)
+
+	deleted, err = repo.SoftDelete(ctx, planet.ID, 3, time.Now())
+	require.Nil(t, err)
+	require.True(t, deleted)
+
+	//planets in the trash are not written
+	planet.Version = 4
+	replaced, err = repo.Replace(ctx, planet)
+	require.Nil(t, err)
+	require.False(t, replaced)
+
+	updated, err = repo.UpdateAppearances(ctx, planet)
+	require.Nil(t, err)
+	require.False(t, updated)
+}
+
+func testSearchAfterAndForEach(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+	created := time.Date(2021, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, name := range []string{"Tatooine", "Hoth", "Naboo"} {
+		planet := models.Planet{ID: primitive.NewObjectID(), Name: name, CreatedAt: created.Add(time.Duration(i) * time.Hour)}
+		require.Nil(t, repo.Insert(ctx, planet))
+	}
+
+	first, err := repo.SearchAfter(ctx, services.SearchFilter{}, nil, 2)
+	require.Nil(t, err)
+	require.Len(t, first, 2)
+	require.Equal(t, "Tatooine", first[0].Name)
+
+	rest, err := repo.SearchAfter(ctx, services.SearchFilter{}, &services.Cursor{CreatedAt: first[1].CreatedAt, ID: first[1].ID}, 2)
+	require.Nil(t, err)
+	require.Len(t, rest, 1)
+	require.Equal(t, "Naboo", rest[0].Name)
+
+	names := []string{}
+	err = repo.ForEach(ctx, services.SearchFilter{}, []services.SortField{{Field: "name", Descending: true}}, func(planet models.Planet) error {
+		names = append(names, planet.Name)
+		return nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"Tatooine", "Naboo", "Hoth"}, names)
+}
+
+func testFindStale(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, planet := range []models.Planet{
+		{Name: "Tatooine", LookupStatus: string(swapi.StatusMatched), AppearancesUpdatedAt: now},
+		{Name: "Hoth", LookupStatus: string(swapi.StatusUpstreamError), AppearancesUpdatedAt: now},
+		{Name: "Naboo", LookupStatus: string(swapi.StatusMatched), AppearancesUpdatedAt: now.Add(-48 * time.Hour)},
+	} {
+		planet.ID = primitive.NewObjectID()
+		require.Nil(t, repo.Insert(ctx, planet))
+	}
+
+	stale, err := repo.FindStale(ctx, now.Add(-24*time.Hour), 10)
+	require.Nil(t, err)
+	require.Len(t, stale, 2)
+	require.Equal(t, "Naboo", stale[0].Name)
+	require.Equal(t, "Hoth", stale[1].Name)
+
+	stale, err = repo.FindStale(ctx, now.Add(-24*time.Hour), 1)
+	require.Nil(t, err)
+	require.Len(t, stale, 1)
+}
+
+func testStoresEveryPlanetField(t *testing.T, repo services.PlanetRepository) {
+	ctx := context.Background()
+	population := int64(200000)
+
+	//mongo keeps times in milliseconds
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	planet := models.Planet{
+		ID:                   primitive.NewObjectID(),
+		Name:                 "Tatooine",
+		Climate:              "arid",
+		Terrain:              "desert",
+		LookupStatus:         string(swapi.StatusMatched),
+		AppearancesUpdatedAt: now,
+		CreatedAt:            now,
+		Swapi:                &models.SwapiAttributes{Name: "Tatooine", Population: &population, Films: []string{"1"}},
+		Version:              1,
+	}
+	require.Nil(t, repo.Insert(ctx, planet))
+
+	found, err := repo.FindByID(ctx, planet.ID)
+	require.Nil(t, err)
+	require.Equal(t, 0, found.Appearances)
+	require.Nil(t, found.DeletedAt)
+	require.True(t, now.Equal(found.CreatedAt))
+	require.True(t, now.Equal(found.AppearancesUpdatedAt))
+	require.Equal(t, population, *found.Swapi.Population)
+	require.Equal(t, int64(1), found.Version)
+}
+
+func TestMemoryRepositoryConcurrentInserts(t *testing.T) {
+	repo := services.NewMemoryPlanetRepository()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			repo.Insert(ctx, models.Planet{ID: primitive.NewObjectID(), Name: fmt.Sprintf("Tund %v", i)})
+		}(i)
+	}
+	wg.Wait()
+
+	res, err := repo.Search(ctx, services.SearchFilter{Name: "tund"}, services.Pagination{Page: 1, PerPage: 100})
+	require.Nil(t, err)
+	require.Equal(t, int64(50), res.Total)
+}
@@ -4,22 +4,31 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"io/ioutil"
-	"net/http"
 	"strings"
 	"time"
 
 	"github.com/Azuos0/b2w_challenge/app/database"
 	"github.com/Azuos0/b2w_challenge/app/models"
-	mongopagination "github.com/gobeam/mongo-go-pagination"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/Azuos0/b2w_challenge/app/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type PlanetService struct {
-	Collection *mongo.Collection
+	Repository PlanetRepository
+	Revisions  RevisionRepository
+	Swapi      swapi.Client
+	// MaxPageSize caps the PerPage requested on Search
+	MaxPageSize int64
+	// MaxBulkSize caps the planets sent at once to BulkCreate
+	MaxBulkSize int
+	// MaxImportSize caps the size, in bytes, of the files sent to Import
+	MaxImportSize int64
+	// Author is recorded on the revisions of the changes made by the service
+	Author string
+	// Timeouts bound each operation, within the deadline of its context
+	Timeouts Timeouts
 }
 
 type SearchResponse struct {
@@ -30,155 +39,462 @@ type SearchResponse struct {
 	Total     int64           `json:"total"`
 	TotalPage int64           `json:"totalPage"`
 	Result    []models.Planet `json:"result"`
+	// NextCursor is only set on cursor pagination, while there are more results
+	NextCursor string `json:"nextCursor,omitempty"`
 }
 
-type swapiPlanetResponse struct {
-	Count   int           `json:"count"`
-	Results []swapiPlanet `json:"results"`
-}
+func NewPlanetService(db *mongo.Database) *PlanetService {
+	client := NewPlanetServiceWithRepository(NewMongoPlanetRepository(database.GetCollection(db, "planets")), swapi.NewClient("", nil))
+	client.Revisions = NewMongoRevisionRepository(database.GetCollection(db, "planet_revisions"))
 
-type swapiPlanet struct {
-	Name            string   `json:"name"`
-	Rotation_period string   `json:"rotation_period"`
-	Orbital_period  string   `json:"orbital_period"`
-	Diameter        string   `json:"diameter"`
-	Climate         string   `json:"climate"`
-	Gravity         string   `json:"gravity"`
-	Terrain         string   `json:"terrain"`
-	Surface_water   string   `json:"surface_water"`
-	Population      string   `json:"population"`
-	Residents       []string `json:"residents"`
-	Films           []string `json:"films"`
+	return client
 }
 
-func NewPlanetService(db *mongo.Database) *PlanetService {
+// NewPlanetServiceWithRepository keeps the history of the planets in memory,
+// set Revisions to store it elsewhere
+func NewPlanetServiceWithRepository(repository PlanetRepository, swapiClient swapi.Client) *PlanetService {
 	client := &PlanetService{
-		Collection: database.GetCollection(db, "planets"),
+		Repository:    repository,
+		Revisions:     NewMemoryRevisionRepository(),
+		Swapi:         swapiClient,
+		MaxPageSize:   DefaultMaxPageSize,
+		MaxBulkSize:   DefaultMaxBulkSize,
+		MaxImportSize: DefaultMaxImportSize,
+		Timeouts:      DefaultTimeouts,
 	}
 
 	return client
 }
 
-func (client *PlanetService) Create(planet models.Planet) (*models.Planet, error) {
-	planet.ID = primitive.NewObjectID()
-	planet.Appearances, _ = getPlanetNumberOfApperances(planet.Name)
-	planet.CreatedAt = time.Now()
+// WithAuthor returns a copy of the service recording author on the revisions
+func (client *PlanetService) WithAuthor(author string) *PlanetService {
+	service := *client
+	service.Author = author
+
+	return &service
+}
+
+func (client *PlanetService) Create(ctx context.Context, planet models.Planet) (*models.Planet, error) {
+	if err := validate(&planet); err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
 	defer cancel()
 
-	res, err := client.Collection.InsertOne(ctx, planet)
+	planet = newPlanet(planet)
+	client.resolveAppearances(ctx, &planet)
+	planet.CreatedAt = time.Now()
+
+	err := client.Repository.Insert(ctx, planet)
+	if err != nil {
+		return nil, client.conflictError(ctx, planet, err)
+	}
+
+	created, err := client.Repository.FindByID(ctx, planet.ID)
+	if err != nil {
+		return nil, storageError(err, planetNotFound(planet.ID))
+	}
+
+	client.recordRevision(ctx, models.ActionCreate, nil, *created, 0)
+
+	return created, nil
+}
+
+// newPlanet resets the fields managed by the server on a planet about to be created
+func newPlanet(planet models.Planet) models.Planet {
+	planet.ID = primitive.NewObjectID()
+	planet.Appearances = 0
+	planet.Swapi = nil
+	planet.DeletedAt = nil
+	planet.Version = 1
+
+	return planet
+}
+
+func (client *PlanetService) Get(ctx context.Context, id string) (*models.Planet, error) {
+	_id, err := parseID(id)
 	if err != nil {
 		return nil, err
 	}
 
-	id := res.InsertedID.(primitive.ObjectID).Hex()
-	return client.Get(id)
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	planet, err := client.Repository.FindByID(ctx, _id)
+	if err != nil {
+		return nil, storageError(err, planetNotFound(_id))
+	}
+
+	return planet, nil
 }
 
-func (client *PlanetService) Get(id string) (*models.Planet, error) {
-	planet := models.Planet{}
+// Update replaces the planet, as long as it is still at version. Any version
+// is replaced when it is 0.
+func (client *PlanetService) Update(ctx context.Context, id string, planet models.Planet, version int64) (*models.Planet, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validate(&planet); err != nil {
+		return nil, err
+	}
 
-	_id, err := primitive.ObjectIDFromHex(id)
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
+	defer cancel()
+
+	current, err := client.findVersion(ctx, _id, version)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	updated, err := client.replace(ctx, current, planet)
+	if err != nil {
+		return nil, err
+	}
+
+	client.recordRevision(ctx, models.ActionUpdate, current, *updated, 0)
+
+	return updated, nil
+}
+
+// Patch applies a JSON Merge Patch document to the stored planet, as long as
+// it is still at version. Any version is patched when it is 0.
+func (client *PlanetService) Patch(ctx context.Context, id string, patch []byte, version int64) (*models.Planet, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
 	defer cancel()
 
-	err = client.Collection.FindOne(ctx, bson.M{"_id": _id}).Decode(&planet)
+	current, err := client.findVersion(ctx, _id, version)
 	if err != nil {
 		return nil, err
 	}
 
-	return &planet, nil
+	original, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := utils.MergePatch(original, patch)
+	if err != nil {
+		return nil, NewErrValidation(err)
+	}
+
+	planet, err := models.DecodePlanet(patched)
+	if err != nil {
+		return nil, NewErrValidation(err)
+	}
+
+	err = validate(&planet)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := client.replace(ctx, current, planet)
+	if err != nil {
+		return nil, err
+	}
+
+	client.recordRevision(ctx, models.ActionUpdate, current, *updated, 0)
+
+	return updated, nil
+}
+
+// replace stores planet in place of current, keeping the fields managed by the
+// server. It fails with ErrVersionMismatch when current was written meanwhile.
+func (client *PlanetService) replace(ctx context.Context, current *models.Planet, planet models.Planet) (*models.Planet, error) {
+	planet.ID = current.ID
+	planet.Version = current.Version
+	planet.CreatedAt = current.CreatedAt
+	planet.Appearances = current.Appearances
+	planet.AppearancesUpdatedAt = current.AppearancesUpdatedAt
+	planet.LookupStatus = current.LookupStatus
+	planet.Swapi = current.Swapi
+	planet.DeletedAt = current.DeletedAt
+
+	//a renamed planet may be a different one on swapi
+	if !strings.EqualFold(planet.Name, current.Name) {
+		planet.Appearances = 0
+		planet.Swapi = nil
+		client.resolveAppearances(ctx, &planet)
+	}
+
+	replaced, err := client.Repository.Replace(ctx, planet)
+	if err != nil {
+		return nil, client.conflictError(ctx, planet, err)
+	}
+
+	if !replaced {
+		return nil, client.writeConflict(ctx, planet.ID)
+	}
+
+	updated, err := client.Repository.FindByID(ctx, planet.ID)
+	if err != nil {
+		return nil, storageError(err, planetNotFound(planet.ID))
+	}
+
+	return updated, nil
+}
+
+// findVersion finds the planet, failing with ErrVersionMismatch when it is
+// not at version, unless it is 0
+func (client *PlanetService) findVersion(ctx context.Context, id primitive.ObjectID, version int64) (*models.Planet, error) {
+	planet, err := client.Repository.FindByID(ctx, id)
+	if err != nil {
+		return nil, storageError(err, planetNotFound(id))
+	}
+
+	if version != 0 && planet.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	return planet, nil
 }
 
-func (client *PlanetService) Delete(id string) (string, error) {
-	_id, err := primitive.ObjectIDFromHex(id)
+// writeConflict tells why a write guarded by the version of the planet did
+// not match it: either the planet is gone or it was written meanwhile
+func (client *PlanetService) writeConflict(ctx context.Context, id primitive.ObjectID) error {
+	_, err := client.Repository.FindByID(ctx, id)
+	if err != nil {
+		return storageError(err, planetNotFound(id))
+	}
+
+	return ErrVersionMismatch
+}
+
+// Delete moves the planet to the trash, from where it can be restored until
+// it is purged, as long as it is still at version. Any version is deleted
+// when it is 0.
+func (client *PlanetService) Delete(ctx context.Context, id string, version int64) (string, error) {
+	_id, err := parseID(id)
 	if err != nil {
 		return "", err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
 	defer cancel()
 
-	res, err := client.Collection.DeleteOne(ctx, bson.M{"_id": _id})
+	current, err := client.findVersion(ctx, _id, version)
 	if err != nil {
 		return "", err
 	}
 
-	if res.DeletedCount > 0 {
-		return "Planet was deleted successfully!", nil
-	} else {
-		err = errors.New("no planet with this id was found in this so far far away galaxy")
-		return "", err
+	deletedAt := time.Now().Truncate(time.Millisecond).UTC()
+
+	deleted, err := client.Repository.SoftDelete(ctx, _id, current.Version, deletedAt)
+	if err != nil {
+		return "", storageError(err, nil)
 	}
 
+	if !deleted {
+		return "", client.writeConflict(ctx, _id)
+	}
+
+	trashed := *current
+	trashed.DeletedAt = &deletedAt
+	trashed.Version++
+	client.recordRevision(ctx, models.ActionDelete, current, trashed, 0)
+
+	return "Planet was deleted successfully!", nil
 }
 
-func getPlanetNumberOfApperances(name string) (int, error) {
-	swapiRes := swapiPlanetResponse{}
-	name = strings.ReplaceAll(name, " ", "%20") //replace whitespaces for equivalent %20 for url
+// Restore takes the planet out of the trash, as long as it is still at
+// version. Any version is restored when it is 0.
+func (client *PlanetService) Restore(ctx context.Context, id string, version int64) (*models.Planet, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
+	defer cancel()
 
-	res, err := http.Get(fmt.Sprintf("https://swapi.dev/api/planets/?search=%v", name))
+	trashed, err := client.Repository.FindInTrash(ctx, _id)
 	if err != nil {
-		return 0, err
+		return nil, storageError(err, &ErrNotFound{Resource: "planet in the trash", ID: id})
 	}
 
-	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
+	if version != 0 && trashed.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	restored, err := client.Repository.Restore(ctx, _id, trashed.Version)
 	if err != nil {
-		return 0, err
+		return nil, storageError(err, nil)
+	}
+
+	//it was restored or deleted again meanwhile
+	if !restored {
+		return nil, ErrVersionMismatch
 	}
 
-	err = json.Unmarshal(body, &swapiRes)
+	planet, err := client.Repository.FindByID(ctx, _id)
 	if err != nil {
-		return 0, err
+		return nil, storageError(err, planetNotFound(_id))
 	}
 
-	if swapiRes.Count > 1 || swapiRes.Count == 0 {
-		return 0, nil
+	client.recordRevision(ctx, models.ActionRestore, trashed, *planet, 0)
+
+	return planet, nil
+}
+
+// conflictError turns the duplicate key error raised when storing planet into
+// an ErrConflict pointing to the planet that already has its name
+func (client *PlanetService) conflictError(ctx context.Context, planet models.Planet, err error) error {
+	if !mongo.IsDuplicateKeyError(err) {
+		return storageError(err, nil)
 	}
 
-	planetName := swapiRes.Results[0].Name
+	conflict := &ErrConflict{Name: planet.Name}
 
-	//if planets have different names
-	if !strings.EqualFold(name, planetName) {
-		return 0, nil
+	existing, findErr := client.Repository.FindByName(ctx, planet.Name)
+	if findErr == nil {
+		conflict.ExistingID = existing.ID.Hex()
+		conflict.Trashed = existing.DeletedAt != nil
 	}
 
-	return len(swapiRes.Results[0].Films), nil
+	return conflict
 }
 
-func (client *PlanetService) Search(page int64, name string) (*SearchResponse, error) {
-	planets := []models.Planet{}
-	var filter bson.M
-
-	if name == "" {
-		filter = bson.M{}
-	} else {
-		filter = bson.M{"name": bson.M{"$regex": name, "$options": "im"}}
+// Refresh looks the planet up on swapi again and stores its new appearances,
+// as long as it is still at version, unless it is 0
+func (client *PlanetService) Refresh(ctx context.Context, id string, version int64) (*models.Planet, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
 	defer cancel()
 
-	paginatedData, err := mongopagination.New(client.Collection).Context(ctx).Limit(30).Page(page).Filter(filter).Decode(&planets).Find()
+	planet, err := client.Repository.FindByID(ctx, _id)
 	if err != nil {
+		return nil, storageError(err, planetNotFound(_id))
+	}
+
+	if version != 0 && planet.Version != version {
+		return nil, ErrVersionMismatch
+	}
+
+	err = client.refresh(ctx, planet)
+	if errors.Is(err, ErrVersionMismatch) {
+		//the planet was either changed or deleted while it was looked up
+		if _, findErr := client.Repository.FindByID(ctx, _id); findErr != nil {
+			return nil, storageError(findErr, planetNotFound(_id))
+		}
 		return nil, err
 	}
 
+	if err != nil {
+		return nil, storageError(err, planetNotFound(_id))
+	}
+
+	refreshed, err := client.Repository.FindByID(ctx, _id)
+	if err != nil {
+		return nil, storageError(err, planetNotFound(_id))
+	}
+
+	return refreshed, nil
+}
+
+func (client *PlanetService) refresh(ctx context.Context, planet *models.Planet) error {
+	client.resolveAppearances(ctx, planet)
+
+	updated, err := client.Repository.UpdateAppearances(ctx, *planet)
+	if err != nil {
+		return err
+	}
+
+	//the planet changed since it was read, its lookup may be of an old name
+	if !updated {
+		return ErrVersionMismatch
+	}
+
+	return nil
+}
+
+// resolveAppearances sets the number of films the planet appears in and the
+// outcome of the swapi lookup. When swapi fails the last known appearances are
+// kept, so the planet can be refreshed later on.
+func (client *PlanetService) resolveAppearances(ctx context.Context, planet *models.Planet) {
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Swapi)
+	defer cancel()
+
+	res, err := client.Swapi.LookupPlanet(ctx, planet.Name)
+	if err != nil || res == nil {
+		planet.LookupStatus = string(swapi.StatusUpstreamError)
+		return
+	}
+
+	planet.Appearances = res.Appearances
+	planet.LookupStatus = string(res.Status)
+	planet.AppearancesUpdatedAt = time.Now()
+	planet.Swapi = nil
+
+	if res.Planet != nil {
+		planet.Swapi = newSwapiAttributes(res.Planet)
+	}
+}
+
+func (client *PlanetService) Search(ctx context.Context, filter SearchFilter, pagination Pagination) (*SearchResponse, error) {
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	if pagination.Page < 1 {
+		pagination.Page = 1
+	}
+
+	pagination.PerPage = client.pageSize(pagination.PerPage)
+
+	res, err := client.Repository.Search(ctx, filter, pagination)
+	if err != nil {
+		return nil, storageError(err, nil)
+	}
+
+	return res, nil
+}
+
+// SearchByCursor lists planets in creation order, starting right after cursor,
+// or from the first one if it is nil. Unlike Search, pages stay consistent
+// when planets are created or deleted between requests.
+func (client *PlanetService) SearchByCursor(ctx context.Context, filter SearchFilter, cursor *Cursor, perPage int64) (*SearchResponse, error) {
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	perPage = client.pageSize(perPage)
+
+	//one more planet tells whether there is a next page
+	planets, err := client.Repository.SearchAfter(ctx, filter, cursor, perPage+1)
+	if err != nil {
+		return nil, storageError(err, nil)
+	}
+
 	result := SearchResponse{
-		Page:      paginatedData.Pagination.Page,
-		Next:      paginatedData.Pagination.Next,
-		Prev:      paginatedData.Pagination.Prev,
-		PerPage:   paginatedData.Pagination.PerPage,
-		Total:     paginatedData.Pagination.Total,
-		TotalPage: paginatedData.Pagination.TotalPage,
-		Result:    planets,
+		PerPage: perPage,
+		Result:  planets,
+	}
+
+	if int64(len(planets)) > perPage {
+		result.Result = planets[:perPage]
+		result.NextCursor = cursorOf(planets[perPage-1]).Encode()
 	}
 
 	return &result, nil
 }
+
+func (client *PlanetService) pageSize(perPage int64) int64 {
+	if perPage < 1 {
+		perPage = DefaultPageSize
+	}
+
+	if client.MaxPageSize > 0 && perPage > client.MaxPageSize {
+		perPage = client.MaxPageSize
+	}
+
+	return perPage
+}
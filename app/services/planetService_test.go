@@ -3,61 +3,63 @@ package services_test
 import (
 	"context"
 	"errors"
-	"os"
 	"strings"
 	"testing"
-	"time"
 
+	"github.com/Azuos0/b2w_challenge/app/config/configtest"
 	"github.com/Azuos0/b2w_challenge/app/database"
 	"github.com/Azuos0/b2w_challenge/app/models"
 	"github.com/Azuos0/b2w_challenge/app/services"
-	"github.com/joho/godotenv"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/Azuos0/b2w_challenge/app/swapi/swapitest"
 	"github.com/stretchr/testify/require"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func loadDatabase() *mongo.Database {
-	dbName := os.Getenv("MONGODB_TEST_DATABASE")
-
-	//load env variables if they are not loaded yet,
-	if dbName == "" {
-		godotenv.Load("../../.env")
-		_ = os.Getenv("MONGODB_TEST_DATABASE")
-		dbName = os.Getenv("MONGODB_TEST_DATABASE")
-	}
-
-	db, _ := database.Connect(dbName)
+	db, _ := database.Connect(configtest.Mongo())
 
 	return db
 }
 
-func clearDatabase(collection *mongo.Collection) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	collection.Drop(ctx)
-	defer cancel()
+var repository = services.NewMemoryPlanetRepository()
+var swapiClient = swapi.NewClient(swapitest.NewServer().URL, nil)
+
+func clearDatabase(repository *services.MemoryPlanetRepository) {
+	repository.Clear()
 }
 
 func mockPlanet(mockPlanet models.Planet) (*models.Planet, *services.PlanetService) {
-	db := loadDatabase()
-	service := services.NewPlanetService(db)
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
 
-	newPlanet, _ := service.Create(mockPlanet)
+	newPlanet, _ := service.Create(context.Background(), mockPlanet)
 
 	return newPlanet, service
 }
 
 func TestNewPlanetService(t *testing.T) {
 	db := loadDatabase()
+	if db == nil {
+		t.Skip("no MongoDB configured")
+	}
+
 	service := services.NewPlanetService(db)
 
 	require.NotNil(t, service)
-	require.NotNil(t, service.Collection)
+	require.NotNil(t, service.Repository)
+}
+
+func TestNewPlanetServiceWithRepository(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
+
+	require.NotNil(t, service)
+	require.Equal(t, repository, service.Repository)
+	require.Equal(t, swapiClient, service.Swapi)
 }
 
 func TestCreateNewPlanet(t *testing.T) {
-	db := loadDatabase()
-	service := services.NewPlanetService(db)
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
 
 	mockPlanet := models.Planet{
 		Name:    "Tatooine",
@@ -65,13 +67,13 @@ func TestCreateNewPlanet(t *testing.T) {
 		Terrain: "Desert",
 	}
 
-	newPlanet, err := service.Create(mockPlanet)
+	newPlanet, err := service.Create(context.Background(), mockPlanet)
 
 	require.NotNil(t, newPlanet.ID)
-	require.NotNil(t, newPlanet.Appearances)
+	require.Equal(t, 5, newPlanet.Appearances)
 	require.Nil(t, err)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestGetPlanetWithValidId(t *testing.T) {
@@ -84,11 +86,11 @@ func TestGetPlanetWithValidId(t *testing.T) {
 	mockedPlanet, service := mockPlanet(planet)
 	id := mockedPlanet.ID.Hex()
 
-	insertedPlanet, err := service.Get(id)
+	insertedPlanet, err := service.Get(context.Background(), id)
 
 	require.Equal(t, mockedPlanet, insertedPlanet)
 	require.Nil(t, err)
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestGetNonExistentPlanet(t *testing.T) {
@@ -101,12 +103,12 @@ func TestGetNonExistentPlanet(t *testing.T) {
 	_, service := mockPlanet(planet)
 	id := primitive.NewObjectID().Hex()
 
-	p, err := service.Get(id)
+	p, err := service.Get(context.Background(), id)
 
 	require.Nil(t, p)
-	require.Equal(t, mongo.ErrNoDocuments, err)
+	require.IsType(t, &services.ErrNotFound{}, err)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestGetInvalidId(t *testing.T) {
@@ -119,12 +121,12 @@ func TestGetInvalidId(t *testing.T) {
 	_, service := mockPlanet(planet)
 	id := "234567"
 
-	p, err := service.Get(id)
+	p, err := service.Get(context.Background(), id)
 
 	require.Nil(t, p)
-	require.Equal(t, errors.New("the provided hex string is not a valid ObjectID"), err)
+	require.Equal(t, &services.ErrInvalidID{ID: "234567"}, err)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestListPlanets(t *testing.T) {
@@ -143,7 +145,7 @@ func TestListPlanets(t *testing.T) {
 	mock1, service := mockPlanet(planet1)
 	mock2, _ := mockPlanet(planet2)
 
-	res, err := service.Search(1, "")
+	res, err := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{Page: 1})
 
 	planets := []models.Planet{*mock1, *mock2}
 
@@ -155,7 +157,7 @@ func TestListPlanets(t *testing.T) {
 	require.Contains(t, res.Result, *mock1)
 	require.Contains(t, res.Result, *mock2)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestSearchPlanet(t *testing.T) {
@@ -174,13 +176,13 @@ func TestSearchPlanet(t *testing.T) {
 	mockedPlanet, service := mockPlanet(planet1)
 	mockPlanet(planet2)
 
-	res, err := service.Search(1, mockedPlanet.Name)
+	res, err := service.Search(context.Background(), services.SearchFilter{Name: mockedPlanet.Name}, services.Pagination{Page: 1})
 
 	require.Nil(t, err)
 	require.Equal(t, int64(1), res.Total)
 	require.Contains(t, res.Result, *mockedPlanet)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestSearchPlanetWithStringCaseInsensitve(t *testing.T) {
@@ -199,19 +201,19 @@ func TestSearchPlanetWithStringCaseInsensitve(t *testing.T) {
 	mockedPlanet1, service := mockPlanet(planet1)
 	mockedPlanet2, _ := mockPlanet(planet2)
 
-	res1, err := service.Search(1, strings.ToUpper(mockedPlanet1.Name))
+	res1, err := service.Search(context.Background(), services.SearchFilter{Name: strings.ToUpper(mockedPlanet1.Name)}, services.Pagination{Page: 1})
 
 	require.Nil(t, err)
 	require.Equal(t, int64(1), res1.Total)
 	require.Contains(t, res1.Result, *mockedPlanet1)
 
-	res2, err := service.Search(1, strings.ToUpper(mockedPlanet2.Name))
+	res2, err := service.Search(context.Background(), services.SearchFilter{Name: strings.ToUpper(mockedPlanet2.Name)}, services.Pagination{Page: 1})
 
 	require.Nil(t, err)
 	require.Equal(t, int64(1), res2.Total)
 	require.Contains(t, res2.Result, *mockedPlanet2)
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
 }
 
 func TestDeletePlanet(t *testing.T) {
@@ -224,10 +226,45 @@ func TestDeletePlanet(t *testing.T) {
 	mockedPlanet, service := mockPlanet(planet)
 	id := mockedPlanet.ID.Hex()
 
-	res, err := service.Delete(id)
+	res, err := service.Delete(context.Background(), id, 0)
 
 	require.Nil(t, err)
 	require.Equal(t, "Planet was deleted successfully!", res)
+
+	clearDatabase(repository)
+}
+
+func TestDeletedPlanetGoesToTrash(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Arid",
+		Terrain: "Desert",
+	}
+
+	mockedPlanet, service := mockPlanet(planet)
+	id := mockedPlanet.ID.Hex()
+
+	service.Delete(context.Background(), id, 0)
+
+	_, err := service.Get(context.Background(), id)
+	require.IsType(t, &services.ErrNotFound{}, err)
+
+	res, _ := service.Search(context.Background(), services.SearchFilter{}, services.Pagination{})
+	require.Equal(t, int64(0), res.Total)
+
+	res, _ = service.Search(context.Background(), services.SearchFilter{Deleted: true}, services.Pagination{})
+	require.Equal(t, int64(1), res.Total)
+	require.NotNil(t, res.Result[0].DeletedAt)
+
+	restored, err := service.Restore(context.Background(), id, 0)
+	require.Nil(t, err)
+	require.Equal(t, mockedPlanet.Name, restored.Name)
+	require.Nil(t, restored.DeletedAt)
+
+	_, err = service.Restore(context.Background(), id, 0)
+	require.IsType(t, &services.ErrNotFound{}, err)
+
+	clearDatabase(repository)
 }
 
 func TestDeletePlanetNotFound(t *testing.T) {
@@ -240,10 +277,236 @@ func TestDeletePlanetNotFound(t *testing.T) {
 	_, service := mockPlanet(planet)
 	id := primitive.NewObjectID().Hex()
 
-	res, err := service.Delete(id)
+	res, err := service.Delete(context.Background(), id, 0)
 
 	require.Equal(t, "", res)
 	require.Equal(t, "no planet with this id was found in this so far far away galaxy", err.Error())
 
-	clearDatabase(service.Collection)
+	clearDatabase(repository)
+}
+
+func TestUpdatePlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Arid",
+		Terrain: "Desert",
+	}
+
+	mockedPlanet, service := mockPlanet(planet)
+
+	update := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Temperate",
+		Terrain: "Desert",
+	}
+
+	updatedPlanet, err := service.Update(context.Background(), mockedPlanet.ID.Hex(), update, 0)
+
+	require.Nil(t, err)
+	require.Equal(t, mockedPlanet.ID, updatedPlanet.ID)
+	require.Equal(t, mockedPlanet.CreatedAt, updatedPlanet.CreatedAt)
+	require.Equal(t, "temperate", updatedPlanet.Climate)
+
+	clearDatabase(repository)
+}
+
+func TestUpdateNonExistentPlanet(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
+	id := primitive.NewObjectID().Hex()
+
+	p, err := service.Update(context.Background(), id, models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"}, 0)
+
+	require.Nil(t, p)
+	require.IsType(t, &services.ErrNotFound{}, err)
+}
+
+func TestPatchPlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Arid",
+		Terrain: "Desert",
+	}
+
+	mockedPlanet, service := mockPlanet(planet)
+
+	patchedPlanet, err := service.Patch(context.Background(), mockedPlanet.ID.Hex(), []byte(`{"terrain": "Desert, mountains", "appearances": 99}`), 0)
+
+	require.Nil(t, err)
+	require.Equal(t, mockedPlanet.ID, patchedPlanet.ID)
+	require.Equal(t, "Tatooine", patchedPlanet.Name)
+	require.Equal(t, "arid", patchedPlanet.Climate)
+	require.Equal(t, "desert, mountains", patchedPlanet.Terrain)
+	require.Equal(t, mockedPlanet.Appearances, patchedPlanet.Appearances)
+
+	clearDatabase(repository)
+}
+
+func TestPatchPlanetRemovingRequiredField(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Arid",
+		Terrain: "Desert",
+	}
+
+	mockedPlanet, service := mockPlanet(planet)
+
+	p, err := service.Patch(context.Background(), mockedPlanet.ID.Hex(), []byte(`{"climate": null}`), 0)
+
+	require.Nil(t, p)
+	require.Error(t, err)
+
+	clearDatabase(repository)
+}
+
+func TestCreatePlanetStoresSwapiAttributes(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(repository, swapiClient)
+
+	tatooine, err := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+
+	require.Nil(t, err)
+	require.Equal(t, "Tatooine", tatooine.Swapi.Name)
+	require.Equal(t, int64(23), *tatooine.Swapi.RotationPeriod)
+	require.Equal(t, int64(10465), *tatooine.Swapi.Diameter)
+	require.Equal(t, "1 standard", *tatooine.Swapi.Gravity)
+	require.Equal(t, float64(1), *tatooine.Swapi.SurfaceWater)
+	require.Equal(t, int64(200000), *tatooine.Swapi.Population)
+	require.Len(t, tatooine.Swapi.Films, 5)
+
+	hoth, err := service.Create(context.Background(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	require.Nil(t, err)
+	require.Nil(t, hoth.Swapi.Population)
+
+	unknown, err := service.Create(context.Background(), models.Planet{Name: "DARTH VADER PLANET", Climate: "Dark", Terrain: "Dark"})
+
+	require.Nil(t, err)
+	require.Nil(t, unknown.Swapi)
+
+	clearDatabase(repository)
+}
+
+func TestCreateDuplicatePlanet(t *testing.T) {
+	planet := models.Planet{
+		Name:    "Tatooine",
+		Climate: "Arid",
+		Terrain: "Desert",
+	}
+
+	mockedPlanet, service := mockPlanet(planet)
+
+	planet.Name = "tatooine"
+	p, err := service.Create(context.Background(), planet)
+
+	var conflict *services.ErrConflict
+	require.Nil(t, p)
+	require.True(t, errors.As(err, &conflict))
+	require.Equal(t, mockedPlanet.ID.Hex(), conflict.ExistingID)
+
+	clearDatabase(repository)
+}
+
+func TestCreatePlanetNamedAsATrashedOne(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+	trashed, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	service.Delete(context.Background(), trashed.ID.Hex(), 0)
+
+	_, err := service.Create(context.Background(), models.Planet{Name: "TATOOINE", Climate: "Arid", Terrain: "Desert"})
+
+	var conflict *services.ErrConflict
+	require.ErrorAs(t, err, &conflict)
+	require.True(t, conflict.Trashed)
+	require.Equal(t, trashed.ID.Hex(), conflict.ExistingID)
+	require.Contains(t, err.Error(), "trash")
+}
+
+func TestRenamePlanetToExistingName(t *testing.T) {
+	tatooine, service := mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	hoth, _ := mockPlanet(models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	_, err := service.Patch(context.Background(), hoth.ID.Hex(), []byte(`{"name": "TATOOINE"}`), 0)
+
+	var conflict *services.ErrConflict
+	require.True(t, errors.As(err, &conflict))
+	require.Equal(t, tatooine.ID.Hex(), conflict.ExistingID)
+
+	clearDatabase(repository)
+}
+
+func TestWriteStaleVersion(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	id := planet.ID.Hex()
+	require.Equal(t, int64(1), planet.Version)
+
+	updated, err := service.Update(context.Background(), id, models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Dunes"}, 1)
+	require.Nil(t, err)
+	require.Equal(t, int64(2), updated.Version)
+
+	_, err = service.Update(context.Background(), id, models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"}, 1)
+	require.Equal(t, services.ErrVersionMismatch, err)
+
+	_, err = service.Patch(context.Background(), id, []byte(`{"terrain": "Desert"}`), 1)
+	require.Equal(t, services.ErrVersionMismatch, err)
+
+	_, err = service.Delete(context.Background(), id, 1)
+	require.Equal(t, services.ErrVersionMismatch, err)
+
+	_, err = service.Delete(context.Background(), id, 2)
+	require.Nil(t, err)
+
+	_, err = service.Restore(context.Background(), id, 2)
+	require.Equal(t, services.ErrVersionMismatch, err)
+
+	restored, err := service.Restore(context.Background(), id, 3)
+	require.Nil(t, err)
+	require.Equal(t, int64(4), restored.Version)
+
+	//appearances are versioned like any other field, so ETags of the
+	//planet before the refresh are stale
+	refreshed, _ := service.Refresh(context.Background(), id, 4)
+	require.Equal(t, int64(5), refreshed.Version)
+
+	_, err = service.Refresh(context.Background(), id, 4)
+	require.ErrorIs(t, err, services.ErrVersionMismatch)
+}
+
+// unavailableRepository fails every lookup as an unreachable database would
+type unavailableRepository struct {
+	services.PlanetRepository
+}
+
+func (unavailableRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	return nil, errors.New("server selection error: connection refused")
+}
+
+func TestServiceErrorsAreTyped(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	_, err := service.Create(context.Background(), models.Planet{Name: "Tatooine"})
+	var validation *services.ErrValidation
+	require.ErrorAs(t, err, &validation)
+	require.Equal(t, map[string]string{"climate": "Missing required field", "terrain": "Missing required field"}, validation.Fields)
+	require.Equal(t, "climate: Missing required field; terrain: Missing required field", err.Error())
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+
+	_, err = service.Patch(context.Background(), planet.ID.Hex(), []byte(`{"name":`), 0)
+	require.ErrorAs(t, err, &validation)
+	require.NotEmpty(t, validation.Detail)
+
+	_, err = service.Delete(context.Background(), primitive.NewObjectID().Hex(), 0)
+	require.IsType(t, &services.ErrNotFound{}, err)
+
+	_, err = service.Revision(context.Background(), planet.ID.Hex(), 7)
+	require.Equal(t, &services.ErrNotFound{Resource: "revision", ID: "7"}, err)
+
+	_, err = service.History(context.Background(), "tatooine")
+	require.Equal(t, &services.ErrInvalidID{ID: "tatooine"}, err)
+
+	service.Repository = unavailableRepository{}
+	_, err = service.Get(context.Background(), planet.ID.Hex())
+	var upstream *services.ErrUpstream
+	require.ErrorAs(t, err, &upstream)
+	require.Equal(t, "database", upstream.Service)
 }
@@ -0,0 +1,20 @@
+package services
+
+import (
+	"context"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RevisionRepository stores the history of the planets. Last and Find must
+// return mongo.ErrNoDocuments when there is no such revision.
+type RevisionRepository interface {
+	// Append stores revision numbered right after the last one of its planet,
+	// returning the number it was given
+	Append(ctx context.Context, revision models.Revision) (int, error)
+	Last(ctx context.Context, planetID primitive.ObjectID) (*models.Revision, error)
+	Find(ctx context.Context, planetID primitive.ObjectID, number int) (*models.Revision, error)
+	// History returns every revision of the planet, oldest first
+	History(ctx context.Context, planetID primitive.ObjectID) ([]models.Revision, error)
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// History lists every revision of the planet, oldest first. Planets in the
+// trash keep their history, while a planet that does not exist has none and
+// is not found.
+func (client *PlanetService) History(ctx context.Context, id string) ([]models.Revision, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	history, err := client.Revisions.History(ctx, _id)
+	if err != nil {
+		return nil, storageError(err, nil)
+	}
+
+	//planets stored before their history was kept have none
+	if len(history) == 0 {
+		if err := client.findAnywhere(ctx, _id); err != nil {
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+// findAnywhere tells whether the planet exists, in the trash or not
+func (client *PlanetService) findAnywhere(ctx context.Context, id primitive.ObjectID) error {
+	_, err := client.Repository.FindByID(ctx, id)
+	if err == mongo.ErrNoDocuments {
+		_, err = client.Repository.FindInTrash(ctx, id)
+	}
+
+	return storageError(err, planetNotFound(id))
+}
+
+func (client *PlanetService) Revision(ctx context.Context, id string, number int) (*models.Revision, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Read)
+	defer cancel()
+
+	revision, err := client.Revisions.Find(ctx, _id, number)
+	if err != nil {
+		return nil, storageError(err, revisionNotFound(number))
+	}
+
+	return revision, nil
+}
+
+func revisionNotFound(number int) error {
+	return &ErrNotFound{Resource: "revision", ID: strconv.Itoa(number)}
+}
+
+// Revert brings the name, climate and terrain of the planet back to the ones
+// of a previous revision, as an update at version would
+func (client *PlanetService) Revert(ctx context.Context, id string, number int, version int64) (*models.Planet, error) {
+	_id, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withTimeout(ctx, client.Timeouts.Write)
+	defer cancel()
+
+	revision, err := client.Revisions.Find(ctx, _id, number)
+	if err != nil {
+		return nil, storageError(err, revisionNotFound(number))
+	}
+
+	current, err := client.findVersion(ctx, _id, version)
+	if err != nil {
+		return nil, err
+	}
+
+	planet := revision.Planet
+	err = validate(&planet)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted, err := client.replace(ctx, current, planet)
+	if err != nil {
+		return nil, err
+	}
+
+	client.recordRevision(ctx, models.ActionRevert, current, *reverted, number)
+
+	return reverted, nil
+}
+
+// recordRevision appends a revision with planet as it is after a change,
+// diffing it against previous or, when it is unknown, against the last
+// revision. The change is already stored, so a failure is only logged.
+func (client *PlanetService) recordRevision(ctx context.Context, action string, previous *models.Planet, planet models.Planet, revertedTo int) {
+	if previous == nil {
+		last, err := client.Revisions.Last(ctx, planet.ID)
+		if err == nil {
+			previous = &last.Planet
+		} else if err != mongo.ErrNoDocuments {
+			log.Printf("planet %v revision: %v", planet.ID.Hex(), err)
+			return
+		}
+	}
+
+	changes, err := diffPlanets(previous, planet)
+	if err != nil {
+		log.Printf("planet %v revision: %v", planet.ID.Hex(), err)
+		return
+	}
+
+	_, err = client.Revisions.Append(ctx, models.Revision{
+		PlanetID:   planet.ID,
+		Action:     action,
+		Author:     client.Author,
+		Planet:     planet,
+		Changes:    changes,
+		RevertedTo: revertedTo,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Printf("planet %v revision: %v", planet.ID.Hex(), err)
+	}
+}
+
+// diffPlanets lists the fields whose JSON value differs between previous,
+// which may be nil, and planet, sorted by field name. Nested fields, like the
+// swapi attributes, are compared one by one using dotted names.
+func diffPlanets(previous *models.Planet, planet models.Planet) ([]models.FieldChange, error) {
+	before := map[string]interface{}{}
+	after := map[string]interface{}{}
+
+	if previous != nil {
+		if err := remarshal(*previous, &before); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := remarshal(planet, &after); err != nil {
+		return nil, err
+	}
+
+	//every write increases the version, it tells nothing about the change
+	delete(before, "version")
+	delete(after, "version")
+
+	fields := []string{}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	for field := range after {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			changes = append(changes, models.FieldChange{Field: field, From: before[field], To: after[field]})
+		}
+	}
+
+	return changes, nil
+}
+
+// remarshal flattens the JSON of planet into fields
+func remarshal(planet models.Planet, fields *map[string]interface{}) error {
+	data, err := json.Marshal(planet)
+	if err != nil {
+		return err
+	}
+
+	document := map[string]interface{}{}
+	err = json.Unmarshal(data, &document)
+	if err != nil {
+		return err
+	}
+
+	flatten("", document, *fields)
+
+	return nil
+}
+
+func flatten(prefix string, document map[string]interface{}, fields map[string]interface{}) {
+	for key, value := range document {
+		if nested, ok := value.(map[string]interface{}); ok {
+			flatten(prefix+key+".", nested, fields)
+			continue
+		}
+
+		fields[prefix+key] = value
+	}
+}
@@ -0,0 +1,110 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPlanetHistory(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	planet, _ := service.WithAuthor("leia").Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	id := planet.ID.Hex()
+
+	service.WithAuthor("luke").Update(context.Background(), id, models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Dunes"}, 0)
+	service.Delete(context.Background(), id, 0)
+	service.Restore(context.Background(), id, 0)
+
+	history, err := service.History(context.Background(), id)
+	require.Nil(t, err)
+	require.Len(t, history, 4)
+
+	require.Equal(t, 1, history[0].Revision)
+	require.Equal(t, models.ActionCreate, history[0].Action)
+	require.Equal(t, "leia", history[0].Author)
+	require.Contains(t, history[0].Changes, models.FieldChange{Field: "name", From: nil, To: "Tatooine"})
+	require.Contains(t, history[0].Changes, models.FieldChange{Field: "swapi.name", From: nil, To: "Tatooine"})
+
+	require.Equal(t, models.ActionUpdate, history[1].Action)
+	require.Equal(t, "luke", history[1].Author)
+	require.Equal(t, []models.FieldChange{{Field: "terrain", From: "desert", To: "dunes"}}, history[1].Changes)
+	require.Equal(t, "dunes", history[1].Planet.Terrain)
+
+	require.Equal(t, models.ActionDelete, history[2].Action)
+	require.Len(t, history[2].Changes, 1)
+	require.Equal(t, "deletedAt", history[2].Changes[0].Field)
+	require.NotNil(t, history[2].Planet.DeletedAt)
+
+	require.Equal(t, models.ActionRestore, history[3].Action)
+	require.Equal(t, "deletedAt", history[3].Changes[0].Field)
+	require.Nil(t, history[3].Changes[0].To)
+
+	revision, err := service.Revision(context.Background(), id, 2)
+	require.Nil(t, err)
+	require.Equal(t, history[1], *revision)
+
+	_, err = service.Revision(context.Background(), id, 5)
+	require.IsType(t, &services.ErrNotFound{}, err)
+}
+
+func TestHistoryOfAPlanetWithoutRevisions(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	_, err := service.History(context.Background(), primitive.NewObjectID().Hex())
+	require.IsType(t, &services.ErrNotFound{}, err)
+
+	//planets stored without the service have no revisions, even in the trash
+	planet := models.Planet{ID: primitive.NewObjectID(), Name: "Tatooine", Climate: "arid", Terrain: "desert", Version: 1}
+	service.Repository.Insert(context.Background(), planet)
+
+	history, err := service.History(context.Background(), planet.ID.Hex())
+	require.Nil(t, err)
+	require.Empty(t, history)
+
+	service.Repository.SoftDelete(context.Background(), planet.ID, 0, time.Now())
+
+	history, err = service.History(context.Background(), planet.ID.Hex())
+	require.Nil(t, err)
+	require.Empty(t, history)
+}
+
+func TestRevertPlanet(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	id := planet.ID.Hex()
+
+	service.Update(context.Background(), id, models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"}, 0)
+
+	reverted, err := service.Revert(context.Background(), id, 1, 0)
+	require.Nil(t, err)
+	require.Equal(t, "Tatooine", reverted.Name)
+	require.Equal(t, "desert", reverted.Terrain)
+	require.Equal(t, 5, reverted.Appearances)
+
+	last, _ := service.Revision(context.Background(), id, 3)
+	require.Equal(t, models.ActionRevert, last.Action)
+	require.Equal(t, 1, last.RevertedTo)
+
+	_, err = service.Revert(context.Background(), id, 10, 0)
+	require.IsType(t, &services.ErrNotFound{}, err)
+}
+
+func TestRevertToTakenName(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), swapiClient)
+
+	planet, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	service.Update(context.Background(), planet.ID.Hex(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"}, 0)
+	service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+
+	_, err := service.Revert(context.Background(), planet.ID.Hex(), 1, 0)
+
+	var conflict *services.ErrConflict
+	require.ErrorAs(t, err, &conflict)
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Range bounds a numeric value, a nil bound is left open
+type Range struct {
+	Min *float64
+	Max *float64
+}
+
+// SearchFilter holds the criteria a planet must match to be listed on Search
+type SearchFilter struct {
+	Name string
+	// Climates and Terrains match planets having any of the listed values
+	// among their comma separated climates and terrains
+	Climates      []string
+	Terrains      []string
+	Appearances   Range
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Swapi bounds the SwapiNumericFields, keyed by field name
+	Swapi map[string]Range
+	// Deleted lists the planets in the trash instead of the active ones
+	Deleted bool
+}
+
+func (r Range) isEmpty() bool {
+	return r.Min == nil && r.Max == nil
+}
+
+func (r Range) contains(value *float64) bool {
+	if value == nil {
+		return false
+	}
+
+	if r.Min != nil && *value < *r.Min {
+		return false
+	}
+
+	if r.Max != nil && *value > *r.Max {
+		return false
+	}
+
+	return true
+}
+
+func (r Range) query() bson.M {
+	query := bson.M{}
+
+	if r.Min != nil {
+		query["$gte"] = *r.Min
+	}
+
+	if r.Max != nil {
+		query["$lte"] = *r.Max
+	}
+
+	return query
+}
+
+// Query builds the mongo query equivalent to the filter
+func (filter SearchFilter) Query() bson.M {
+	query := bson.M{"deletedAt": nil}
+
+	if filter.Deleted {
+		query["deletedAt"] = bson.M{"$ne": nil}
+	}
+
+	if filter.Name != "" {
+		query["name"] = bson.M{"$regex": filter.Name, "$options": "im"}
+	}
+
+	if len(filter.Climates) > 0 {
+		query["climate"] = bson.M{"$in": listItemPatterns(filter.Climates)}
+	}
+
+	if len(filter.Terrains) > 0 {
+		query["terrain"] = bson.M{"$in": listItemPatterns(filter.Terrains)}
+	}
+
+	if !filter.Appearances.isEmpty() {
+		query["appearances"] = filter.Appearances.query()
+	}
+
+	if filter.CreatedAfter != nil || filter.CreatedBefore != nil {
+		createdAt := bson.M{}
+		if filter.CreatedAfter != nil {
+			createdAt["$gt"] = *filter.CreatedAfter
+		}
+		if filter.CreatedBefore != nil {
+			createdAt["$lt"] = *filter.CreatedBefore
+		}
+		query["createdAt"] = createdAt
+	}
+
+	for field, r := range filter.Swapi {
+		if !r.isEmpty() {
+			query["swapi."+field] = r.query()
+		}
+	}
+
+	return query
+}
+
+// listItemPatterns builds regexes matching whole items of a comma separated list
+func listItemPatterns(items []string) []primitive.Regex {
+	patterns := []primitive.Regex{}
+
+	for _, item := range items {
+		patterns = append(patterns, primitive.Regex{
+			Pattern: `(^|,)\s*` + regexp.QuoteMeta(item) + `\s*(,|$)`,
+			Options: "i",
+		})
+	}
+
+	return patterns
+}
+
+func containsAnyItem(list string, items []string) bool {
+	for _, value := range models.SplitList(list) {
+		for _, item := range items {
+			if strings.EqualFold(value, item) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Matcher returns a function telling whether a planet matches the filter,
+// following the semantics of Query
+func (filter SearchFilter) Matcher() (func(models.Planet) bool, error) {
+	var name *regexp.Regexp
+	var err error
+
+	if filter.Name != "" {
+		//same semantics as the "im" options used with $regex on mongo
+		name, err = regexp.Compile("(?im)" + filter.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(planet models.Planet) bool {
+		if (planet.DeletedAt != nil) != filter.Deleted {
+			return false
+		}
+
+		if name != nil && !name.MatchString(planet.Name) {
+			return false
+		}
+
+		if len(filter.Climates) > 0 && !containsAnyItem(planet.Climate, filter.Climates) {
+			return false
+		}
+
+		if len(filter.Terrains) > 0 && !containsAnyItem(planet.Terrain, filter.Terrains) {
+			return false
+		}
+
+		appearances := float64(planet.Appearances)
+		if !filter.Appearances.isEmpty() && !filter.Appearances.contains(&appearances) {
+			return false
+		}
+
+		if filter.CreatedAfter != nil && !planet.CreatedAt.After(*filter.CreatedAfter) {
+			return false
+		}
+
+		if filter.CreatedBefore != nil && !planet.CreatedAt.Before(*filter.CreatedBefore) {
+			return false
+		}
+
+		for field, r := range filter.Swapi {
+			if !r.isEmpty() && !r.contains(swapiNumber(planet, field)) {
+				return false
+			}
+		}
+
+		return true
+	}, nil
+}
@@ -0,0 +1,114 @@
+package services_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+func TestSearchFilterQuery(t *testing.T) {
+	filter := services.SearchFilter{
+		Name: "tat",
+		Swapi: map[string]services.Range{
+			"population": {Min: float(1000)},
+			"diameter":   {Min: float(10), Max: float(20)},
+			"gravity":    {},
+		},
+	}
+
+	query := filter.Query()
+
+	require.Equal(t, "tat", query["name"].(bson.M)["$regex"])
+	require.Equal(t, float64(1000), query["swapi.population"].(bson.M)["$gte"])
+	require.Equal(t, float64(20), query["swapi.diameter"].(bson.M)["$lte"])
+	require.NotContains(t, query, "swapi.gravity")
+}
+
+func TestSearchBySwapiAttributes(t *testing.T) {
+	tatooine, service := mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	alderaan, _ := mockPlanet(models.Planet{Name: "Alderaan", Climate: "Temperate", Terrain: "Grasslands"})
+	mockPlanet(models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	res, err := service.Search(context.Background(), services.SearchFilter{Swapi: map[string]services.Range{"population": {Min: float(1000)}}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*tatooine, *alderaan}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{Swapi: map[string]services.Range{"population": {Max: float(1000000)}}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*tatooine}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{Swapi: map[string]services.Range{"surfaceWater": {Min: float(50)}}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, int64(1), res.Total)
+	require.Equal(t, "Hoth", res.Result[0].Name)
+
+	clearDatabase(repository)
+}
+
+func TestSearchFilterQueryMatchesWholeListItems(t *testing.T) {
+	filter := services.SearchFilter{Climates: []string{"arid"}}
+
+	patterns := filter.Query()["climate"].(bson.M)["$in"].([]primitive.Regex)
+	require.Len(t, patterns, 1)
+
+	matcher := regexp.MustCompile("(?" + patterns[0].Options + ")" + patterns[0].Pattern)
+	require.True(t, matcher.MatchString("arid"))
+	require.True(t, matcher.MatchString("Temperate, Arid"))
+	require.True(t, matcher.MatchString("arid,windy"))
+	require.False(t, matcher.MatchString("semi-arid"))
+	require.False(t, matcher.MatchString("aridness, hot"))
+}
+
+func TestSearchByClimateTerrainAndAppearances(t *testing.T) {
+	tatooine, service := mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	geonosis, _ := mockPlanet(models.Planet{Name: "Geonosis", Climate: "temperate, arid", Terrain: "rock, desert, mountain, barren"})
+	yavin, _ := mockPlanet(models.Planet{Name: "Yavin IV", Climate: "temperate, tropical", Terrain: "jungle, rainforests"})
+	mockPlanet(models.Planet{Name: "Mustafar", Climate: "hot", Terrain: "volcanoes, semi-desert"})
+
+	res, err := service.Search(context.Background(), services.SearchFilter{Climates: []string{"arid"}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*tatooine, *geonosis}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{Climates: []string{"tropical", "arid"}, Terrains: []string{"JUNGLE"}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*yavin}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{Terrains: []string{"desert"}, Appearances: services.Range{Min: float(2)}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*tatooine}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{Appearances: services.Range{Max: float(1)}}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, int64(3), res.Total)
+
+	clearDatabase(repository)
+}
+
+func TestSearchByCreationDate(t *testing.T) {
+	tatooine, service := mockPlanet(models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	time.Sleep(5 * time.Millisecond)
+	middle := time.Now()
+	time.Sleep(5 * time.Millisecond)
+	hoth, _ := mockPlanet(models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	res, err := service.Search(context.Background(), services.SearchFilter{CreatedAfter: &middle}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*hoth}, res.Result)
+
+	res, err = service.Search(context.Background(), services.SearchFilter{CreatedBefore: &middle}, services.Pagination{Page: 1})
+	require.Nil(t, err)
+	require.Equal(t, []models.Planet{*tatooine}, res.Result)
+
+	clearDatabase(repository)
+}
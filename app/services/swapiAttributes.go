@@ -0,0 +1,95 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+)
+
+// SwapiNumericFields are the numeric swapi attributes planets can be filtered by
+var SwapiNumericFields = []string{"rotationPeriod", "orbitalPeriod", "diameter", "surfaceWater", "population"}
+
+func newSwapiAttributes(planet *swapi.Planet) *models.SwapiAttributes {
+	return &models.SwapiAttributes{
+		Name:           planet.Name,
+		RotationPeriod: parseSwapiInt(planet.RotationPeriod),
+		OrbitalPeriod:  parseSwapiInt(planet.OrbitalPeriod),
+		Diameter:       parseSwapiInt(planet.Diameter),
+		Gravity:        parseSwapiString(planet.Gravity),
+		SurfaceWater:   parseSwapiFloat(planet.SurfaceWater),
+		Population:     parseSwapiInt(planet.Population),
+		Residents:      planet.Residents,
+		Films:          planet.Films,
+	}
+}
+
+// swapiNumber returns the value of one of the SwapiNumericFields of the planet
+func swapiNumber(planet models.Planet, field string) *float64 {
+	if planet.Swapi == nil {
+		return nil
+	}
+
+	var value *int64
+	switch field {
+	case "rotationPeriod":
+		value = planet.Swapi.RotationPeriod
+	case "orbitalPeriod":
+		value = planet.Swapi.OrbitalPeriod
+	case "diameter":
+		value = planet.Swapi.Diameter
+	case "population":
+		value = planet.Swapi.Population
+	case "surfaceWater":
+		return planet.Swapi.SurfaceWater
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	number := float64(*value)
+	return &number
+}
+
+// isSwapiUnknown tells whether swapi has no information about an attribute
+func isSwapiUnknown(value string) bool {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	return value == "" || value == "unknown" || value == "n/a" || value == "none"
+}
+
+func parseSwapiString(value string) *string {
+	if isSwapiUnknown(value) {
+		return nil
+	}
+
+	return &value
+}
+
+func parseSwapiInt(value string) *int64 {
+	if isSwapiUnknown(value) {
+		return nil
+	}
+
+	number, err := strconv.ParseInt(strings.ReplaceAll(value, ",", ""), 10, 64)
+	if err != nil {
+		return nil
+	}
+
+	return &number
+}
+
+func parseSwapiFloat(value string) *float64 {
+	if isSwapiUnknown(value) {
+		return nil
+	}
+
+	number, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil {
+		return nil
+	}
+
+	return &number
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound the operations of a PlanetService, on top of the deadline of
+// the context each one is given. A zero timeout leaves an operation bound by
+// its context only.
+type Timeouts struct {
+	// Read bounds Get, Search, SearchByCursor, History, Revision and the lookup
+	// of stale planets by the AppearancesRefresher
+	Read time.Duration
+	// Write bounds Create, Update, Patch, Delete, Restore, Revert and Refresh
+	Write time.Duration
+	// Bulk bounds BulkCreate and each batch of Import
+	Bulk time.Duration
+	// Export bounds a whole Export, which may take long on big collections
+	Export time.Duration
+	// Swapi bounds each lookup of a planet on swapi
+	Swapi time.Duration
+}
+
+var DefaultTimeouts = Timeouts{
+	Read:   8 * time.Second,
+	Write:  8 * time.Second,
+	Bulk:   30 * time.Second,
+	Export: 10 * time.Minute,
+	Swapi:  5 * time.Second,
+}
+
+// withTimeout bounds ctx by timeout, unless it is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// refresh bounds each planet refreshed by the AppearancesRefresher, long
+// enough to look it up on swapi and then store it, unless either is unbounded
+func (timeouts Timeouts) refresh() time.Duration {
+	if timeouts.Swapi <= 0 || timeouts.Write <= 0 {
+		return 0
+	}
+
+	return timeouts.Swapi + timeouts.Write
+}
@@ -0,0 +1,88 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// hangingClient never answers, waiting for the lookup to be given up
+type hangingClient struct {
+	deadline time.Time
+}
+
+func (client *hangingClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	client.deadline, _ = ctx.Deadline()
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func TestSwapiLookupHonoursTimeouts(t *testing.T) {
+	client := &hangingClient{}
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), client)
+	service.Timeouts.Swapi = 20 * time.Millisecond
+
+	start := time.Now()
+	planet, err := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "arid", Terrain: "desert"})
+
+	require.Nil(t, err)
+	require.Equal(t, string(swapi.StatusUpstreamError), planet.LookupStatus)
+	require.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	//a request deadline shorter than the lookup timeout is kept
+	service.Timeouts.Swapi = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	requestDeadline, _ := ctx.Deadline()
+
+	service.Refresh(ctx, planet.ID.Hex(), 0)
+
+	require.Equal(t, requestDeadline, client.deadline)
+}
+
+// hangingRepository never finds a planet, waiting for the lookup to be given up
+type hangingRepository struct {
+	services.PlanetRepository
+}
+
+func (hangingRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Planet, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingRepository) FindStale(ctx context.Context, updatedBefore time.Time, limit int64) ([]models.Planet, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestReadTimeout(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(hangingRepository{}, swapiClient)
+	service.Timeouts.Read = 20 * time.Millisecond
+
+	_, err := service.Get(context.Background(), primitive.NewObjectID().Hex())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	//a cancelled request gives up as well
+	service.Timeouts = services.Timeouts{}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = service.Get(ctx, primitive.NewObjectID().Hex())
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRefresherLookupOfStalePlanetsTimesOut(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(hangingRepository{}, swapiClient)
+	service.Timeouts.Read = 20 * time.Millisecond
+	refresher := services.NewAppearancesRefresher(service, time.Hour, time.Hour)
+
+	_, err := refresher.RefreshStale(context.Background())
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
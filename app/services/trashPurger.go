@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	DefaultPurgeInterval  = time.Hour
+	DefaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// TrashPurger periodically removes for good the planets kept in the trash for
+// longer than Retention
+type TrashPurger struct {
+	Service   *PlanetService
+	Interval  time.Duration
+	Retention time.Duration
+}
+
+func NewTrashPurger(service *PlanetService, interval time.Duration, retention time.Duration) *TrashPurger {
+	if interval <= 0 {
+		interval = DefaultPurgeInterval
+	}
+
+	if retention <= 0 {
+		retention = DefaultTrashRetention
+	}
+
+	return &TrashPurger{
+		Service:   service,
+		Interval:  interval,
+		Retention: retention,
+	}
+}
+
+// Run purges the expired planets every Interval until ctx is done
+func (purger *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(purger.Interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := purger.PurgeExpired(ctx)
+		if err != nil {
+			log.Printf("trash purger: %v", err)
+		} else if purged > 0 {
+			log.Printf("trash purger: %v planets purged", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeExpired removes the planets kept in the trash for longer than
+// Retention, returning how many were removed
+func (purger *TrashPurger) PurgeExpired(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, purger.Service.Timeouts.Write)
+	defer cancel()
+
+	return purger.Service.Repository.Purge(ctx, time.Now().Add(-purger.Retention))
+}
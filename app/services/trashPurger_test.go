@@ -0,0 +1,40 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/models"
+	"github.com/Azuos0/b2w_challenge/app/services"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeExpiredPlanets(t *testing.T) {
+	service := services.NewPlanetServiceWithRepository(services.NewMemoryPlanetRepository(), &switchableClient{})
+	purger := services.NewTrashPurger(service, time.Hour, time.Hour)
+
+	tatooine, _ := service.Create(context.Background(), models.Planet{Name: "Tatooine", Climate: "Arid", Terrain: "Desert"})
+	hoth, _ := service.Create(context.Background(), models.Planet{Name: "Hoth", Climate: "Frozen", Terrain: "Tundra"})
+
+	service.Repository.SoftDelete(context.Background(), tatooine.ID, 0, time.Now().Add(-2*time.Hour))
+	service.Delete(context.Background(), hoth.ID.Hex(), 0)
+
+	purged, err := purger.PurgeExpired(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, int64(1), purged)
+
+	_, err = service.Restore(context.Background(), tatooine.ID.Hex(), 0)
+	require.IsType(t, &services.ErrNotFound{}, err)
+
+	//the planet deleted just now is still in the trash
+	_, err = service.Restore(context.Background(), hoth.ID.Hex(), 0)
+	require.Nil(t, err)
+}
+
+func TestNewTrashPurgerDefaults(t *testing.T) {
+	purger := services.NewTrashPurger(nil, 0, 0)
+
+	require.Equal(t, services.DefaultPurgeInterval, purger.Interval)
+	require.Equal(t, services.DefaultTrashRetention, purger.Retention)
+}
@@ -0,0 +1,270 @@
+package swapi
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultCacheSize = 1000
+	DefaultCacheTTL  = 24 * time.Hour
+)
+
+// CacheStore persists lookups so they survive restarts. Get must report
+// found=false for missing and expired entries, and when the found ones expire.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (result *LookupResult, expiresAt time.Time, found bool, err error)
+	Set(ctx context.Context, key string, result LookupResult, expiresAt time.Time) error
+}
+
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+}
+
+// CachedClient wraps a Client with an in-process LRU cache, optionally backed
+// by a CacheStore. Upstream errors are never cached.
+type CachedClient struct {
+	Client Client
+	Store  CacheStore
+	Size   int
+	TTL    time.Duration
+	// Timeout bounds the lookups on Client, which are shared by the concurrent
+	// callers of the same name and so do not run on the context of any of
+	// them, going on until the last of them gives up
+	Timeout time.Duration
+
+	hits   uint64
+	misses uint64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	flights map[string]*flight
+}
+
+// flight is a lookup on Client shared by the callers waiting for it, and
+// cancelled when every one of them gives up
+type flight struct {
+	done    chan struct{}
+	result  *LookupResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+type cacheEntry struct {
+	key       string
+	result    LookupResult
+	expiresAt time.Time
+}
+
+// NewCachedClient creates a cache of up to size lookups, each kept for ttl.
+// store may be nil to keep the cache in memory only.
+func NewCachedClient(client Client, size int, ttl time.Duration, store CacheStore) *CachedClient {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+
+	return &CachedClient{
+		Client:  client,
+		Store:   store,
+		Size:    size,
+		TTL:     ttl,
+		Timeout: DefaultTimeout,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		flights: map[string]*flight{},
+	}
+}
+
+func (cache *CachedClient) LookupPlanet(ctx context.Context, name string) (*LookupResult, error) {
+	key := cacheKey(name)
+
+	if result, ok := cache.get(key); ok {
+		atomic.AddUint64(&cache.hits, 1)
+		return result, nil
+	}
+
+	if cache.Store != nil {
+		result, expiresAt, found, err := cache.Store.Get(ctx, key)
+		if err != nil {
+			log.Printf("swapi cache: %v", err)
+		}
+
+		if found {
+			atomic.AddUint64(&cache.hits, 1)
+			cache.set(key, *result, expiresAt)
+			return result, nil
+		}
+	}
+
+	atomic.AddUint64(&cache.misses, 1)
+
+	//concurrent lookups of the same name share a single request to swapi,
+	//which goes on while any of them still waits for it
+	shared := cache.join(key, name)
+
+	select {
+	case <-ctx.Done():
+		cache.leave(key, shared)
+		return nil, ctx.Err()
+	case <-shared.done:
+		result := shared.result
+		if result != nil {
+			copied := *result
+			result = &copied
+		}
+
+		return result, shared.err
+	}
+}
+
+// join waits for the lookup of key, starting it when no other caller did
+func (cache *CachedClient) join(key string, name string) *flight {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if shared, ok := cache.flights[key]; ok {
+		shared.waiters++
+		return shared
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	shared := &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	cache.flights[key] = shared
+
+	go func() {
+		defer cancel()
+
+		shared.result, shared.err = cache.lookup(ctx, key, name)
+
+		cache.mu.Lock()
+		if cache.flights[key] == shared {
+			delete(cache.flights, key)
+		}
+		cache.mu.Unlock()
+
+		close(shared.done)
+	}()
+
+	return shared
+}
+
+// leave stops waiting for a lookup, cancelling it when no one else waits
+func (cache *CachedClient) leave(key string, shared *flight) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	shared.waiters--
+	if shared.waiters > 0 {
+		return
+	}
+
+	shared.cancel()
+
+	//the next caller starts a lookup of its own
+	if cache.flights[key] == shared {
+		delete(cache.flights, key)
+	}
+}
+
+// lookup looks the planet up on Client and caches it, bounded by Timeout
+// within ctx
+func (cache *CachedClient) lookup(ctx context.Context, key string, name string) (*LookupResult, error) {
+	if cache.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cache.Timeout)
+		defer cancel()
+	}
+
+	result, err := cache.Client.LookupPlanet(ctx, name)
+	if err != nil {
+		return result, err
+	}
+
+	expiresAt := time.Now().Add(cache.TTL)
+	cache.set(key, *result, expiresAt)
+
+	if cache.Store != nil {
+		if err := cache.Store.Set(ctx, key, *result, expiresAt); err != nil {
+			log.Printf("swapi cache: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Ping probes the client the cache wraps, when it can be probed, bypassing
+// the cache
+func (cache *CachedClient) Ping(ctx context.Context) error {
+	if pinger, ok := cache.Client.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+
+	return nil
+}
+
+// Stats counts the lookups answered by the cache, from memory or from the
+// store, and the ones that missed it
+func (cache *CachedClient) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadUint64(&cache.hits),
+		Misses: atomic.LoadUint64(&cache.misses),
+	}
+}
+
+func (cache *CachedClient) get(key string) (*LookupResult, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		cache.lru.Remove(element)
+		delete(cache.entries, key)
+		return nil, false
+	}
+
+	cache.lru.MoveToFront(element)
+	result := entry.result
+
+	return &result, true
+}
+
+func (cache *CachedClient) set(key string, result LookupResult, expiresAt time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		element.Value = &cacheEntry{key: key, result: result, expiresAt: expiresAt}
+		cache.lru.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&cacheEntry{key: key, result: result, expiresAt: expiresAt})
+
+	for cache.lru.Len() > cache.Size {
+		oldest := cache.lru.Back()
+		cache.lru.Remove(oldest)
+		delete(cache.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey follows the lookup semantics, where names are compared case insensitively
+func cacheKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
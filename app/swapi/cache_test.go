@@ -0,0 +1,236 @@
+package swapi_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/stretchr/testify/require"
+)
+
+type countingClient struct {
+	calls int32
+	err   error
+}
+
+func (client *countingClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	atomic.AddInt32(&client.calls, 1)
+
+	if client.err != nil {
+		return &swapi.LookupResult{Status: swapi.StatusUpstreamError}, client.err
+	}
+
+	return &swapi.LookupResult{Status: swapi.StatusMatched, Appearances: len(name)}, nil
+}
+
+type mapStore struct {
+	mu      sync.Mutex
+	entries map[string]storedLookup
+}
+
+type storedLookup struct {
+	result    swapi.LookupResult
+	expiresAt time.Time
+}
+
+func (store *mapStore) Get(ctx context.Context, key string) (*swapi.LookupResult, time.Time, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.entries[key]
+	if !ok || time.Now().After(stored.expiresAt) {
+		return nil, time.Time{}, false, nil
+	}
+
+	return &stored.result, stored.expiresAt, true, nil
+}
+
+func (store *mapStore) Set(ctx context.Context, key string, result swapi.LookupResult, expiresAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.entries[key] = storedLookup{result: result, expiresAt: expiresAt}
+	return nil
+}
+
+func TestCachedClientHitsAndMisses(t *testing.T) {
+	client := &countingClient{}
+	cache := swapi.NewCachedClient(client, 10, time.Hour, nil)
+
+	res1, err := cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Nil(t, err)
+
+	res2, err := cache.LookupPlanet(context.Background(), " tatooine ")
+	require.Nil(t, err)
+
+	require.Equal(t, res1, res2)
+	require.Equal(t, int32(1), client.calls)
+	require.Equal(t, swapi.CacheStats{Hits: 1, Misses: 1}, cache.Stats())
+}
+
+func TestCachedClientExpiresEntries(t *testing.T) {
+	client := &countingClient{}
+	cache := swapi.NewCachedClient(client, 10, 10*time.Millisecond, nil)
+
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	time.Sleep(20 * time.Millisecond)
+	cache.LookupPlanet(context.Background(), "Tatooine")
+
+	require.Equal(t, int32(2), client.calls)
+}
+
+func TestCachedClientEvictsLeastRecentlyUsed(t *testing.T) {
+	client := &countingClient{}
+	cache := swapi.NewCachedClient(client, 2, time.Hour, nil)
+
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	cache.LookupPlanet(context.Background(), "Hoth")
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	cache.LookupPlanet(context.Background(), "Naboo")
+
+	//Hoth was the least recently used and has been evicted
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Equal(t, int32(3), client.calls)
+
+	cache.LookupPlanet(context.Background(), "Hoth")
+	require.Equal(t, int32(4), client.calls)
+}
+
+func TestCachedClientDoesNotCacheErrors(t *testing.T) {
+	client := &countingClient{err: errors.New("swapi is down")}
+	cache := swapi.NewCachedClient(client, 10, time.Hour, nil)
+
+	res, err := cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Error(t, err)
+	require.Equal(t, swapi.StatusUpstreamError, res.Status)
+
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Equal(t, int32(2), client.calls)
+}
+
+func TestCachedClientUsesStoreAcrossRestarts(t *testing.T) {
+	client := &countingClient{}
+	store := &mapStore{entries: map[string]storedLookup{}}
+
+	cache := swapi.NewCachedClient(client, 10, time.Hour, store)
+	cache.LookupPlanet(context.Background(), "Tatooine")
+
+	restarted := swapi.NewCachedClient(client, 10, time.Hour, store)
+	res, err := restarted.LookupPlanet(context.Background(), "Tatooine")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+	require.Equal(t, int32(1), client.calls)
+	require.Equal(t, uint64(1), restarted.Stats().Hits)
+}
+
+func TestCachedClientKeepsStoredExpiration(t *testing.T) {
+	client := &countingClient{}
+	store := &mapStore{entries: map[string]storedLookup{}}
+	store.Set(context.Background(), "tatooine", swapi.LookupResult{Status: swapi.StatusMatched}, time.Now().Add(20*time.Millisecond))
+
+	cache := swapi.NewCachedClient(client, 10, time.Hour, store)
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Equal(t, int32(0), client.calls)
+
+	//the entry read from the store expires when it does there, not a TTL later
+	time.Sleep(30 * time.Millisecond)
+	cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Equal(t, int32(1), client.calls)
+}
+
+// blockingClient answers once released, reporting when it is called
+type blockingClient struct {
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (client *blockingClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	close(client.called)
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-client.release:
+		return &swapi.LookupResult{Status: swapi.StatusMatched}, nil
+	}
+}
+
+func TestCachedClientSharedLookupOutlivesItsCaller(t *testing.T) {
+	client := &blockingClient{called: make(chan struct{}), release: make(chan struct{})}
+	cache := swapi.NewCachedClient(client, 10, time.Hour, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.LookupPlanet(ctx, "Tatooine")
+		first <- err
+	}()
+	<-client.called
+
+	second := make(chan *swapi.LookupResult, 1)
+	go func() {
+		res, _ := cache.LookupPlanet(context.Background(), "Tatooine")
+		second <- res
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	//the caller that started the lookup gives up, the other one still waits for it
+	cancel()
+	require.ErrorIs(t, <-first, context.Canceled)
+
+	close(client.release)
+	res := <-second
+	require.NotNil(t, res)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+}
+
+// abandonedClient waits for its lookups to be cancelled, reporting why
+type abandonedClient struct {
+	called    chan struct{}
+	cancelled chan error
+}
+
+func (client *abandonedClient) LookupPlanet(ctx context.Context, name string) (*swapi.LookupResult, error) {
+	close(client.called)
+	<-ctx.Done()
+	client.cancelled <- ctx.Err()
+
+	return nil, ctx.Err()
+}
+
+func TestCachedClientCancelsALookupNoOneWaitsFor(t *testing.T) {
+	client := &abandonedClient{called: make(chan struct{}), cancelled: make(chan error, 1)}
+	cache := swapi.NewCachedClient(client, 10, time.Hour, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := cache.LookupPlanet(ctx, "Tatooine")
+		done <- err
+	}()
+	<-client.called
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+
+	select {
+	case err := <-client.cancelled:
+		require.ErrorIs(t, err, context.Canceled)
+	case <-time.After(time.Second):
+		t.Fatal("the lookup went on after its only caller gave up")
+	}
+
+	//the next caller looks the planet up again
+	next := &blockingClient{called: make(chan struct{}), release: make(chan struct{})}
+	close(next.release)
+	cache.Client = next
+
+	res, err := cache.LookupPlanet(context.Background(), "Tatooine")
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+}
@@ -0,0 +1,190 @@
+package swapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://swapi.dev/api/"
+	DefaultTimeout = 5 * time.Second
+
+	//maxPages protects the lookup against a server that never stops sending next links
+	maxPages = 100
+)
+
+// Client looks planets up on the Star Wars API
+type Client interface {
+	LookupPlanet(ctx context.Context, name string) (*LookupResult, error)
+}
+
+type LookupStatus string
+
+const (
+	// StatusMatched means exactly one planet has the searched name
+	StatusMatched LookupStatus = "matched"
+	// StatusNotFound means no planet has the searched name, although planets
+	// merely containing it may exist
+	StatusNotFound LookupStatus = "not_found"
+	// StatusAmbiguous means more than one planet has the searched name
+	StatusAmbiguous LookupStatus = "ambiguous"
+	// StatusUpstreamError means SWAPI could not be reached or gave an invalid answer
+	StatusUpstreamError LookupStatus = "upstream_error"
+)
+
+type LookupResult struct {
+	Status      LookupStatus `json:"status"`
+	Appearances int          `json:"appearances"`
+	Planet      *Planet      `json:"planet,omitempty"`
+}
+
+// UpstreamError is returned when SWAPI can't be used to resolve a lookup
+type UpstreamError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("swapi: %v", e.Err)
+	}
+
+	return fmt.Sprintf("swapi: responded with status %v", e.StatusCode)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+type PlanetResponse struct {
+	Count    int      `json:"count"`
+	Next     *string  `json:"next"`
+	Previous *string  `json:"previous"`
+	Results  []Planet `json:"results"`
+}
+
+type Planet struct {
+	Name           string   `json:"name"`
+	RotationPeriod string   `json:"rotation_period"`
+	OrbitalPeriod  string   `json:"orbital_period"`
+	Diameter       string   `json:"diameter"`
+	Climate        string   `json:"climate"`
+	Gravity        string   `json:"gravity"`
+	Terrain        string   `json:"terrain"`
+	SurfaceWater   string   `json:"surface_water"`
+	Population     string   `json:"population"`
+	Residents      []string `json:"residents"`
+	Films          []string `json:"films"`
+}
+
+// HTTPClient is the Client implementation that talks to a SWAPI server over http
+type HTTPClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a client for the SWAPI server at baseURL. An empty baseURL
+// points to swapi.dev and a nil httpClient is replaced by one with DefaultTimeout.
+func NewClient(baseURL string, httpClient *http.Client) *HTTPClient {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	return &HTTPClient{
+		BaseURL:    baseURL,
+		HTTPClient: httpClient,
+	}
+}
+
+// LookupPlanet searches SWAPI for the planet called name, case insensitively,
+// going through every page of results. Upstream failures, a server sending
+// more than maxPages pages included, are returned both as a
+// StatusUpstreamError result and as an *UpstreamError.
+func (client *HTTPClient) LookupPlanet(ctx context.Context, name string) (*LookupResult, error) {
+	name = strings.TrimSpace(name)
+	matches := []Planet{}
+
+	next := fmt.Sprintf("%vplanets/?%v", client.BaseURL, url.Values{"search": {name}}.Encode())
+	for page := 0; next != "" && page < maxPages; page++ {
+		res, err := client.getPlanets(ctx, next)
+		if err != nil {
+			return &LookupResult{Status: StatusUpstreamError}, err
+		}
+
+		for _, planet := range res.Results {
+			if strings.EqualFold(name, planet.Name) {
+				matches = append(matches, planet)
+			}
+		}
+
+		next = ""
+		if res.Next != nil {
+			next = *res.Next
+		}
+	}
+
+	//the pages left unread could hold the planet, or another one of its name
+	if next != "" {
+		return &LookupResult{Status: StatusUpstreamError}, &UpstreamError{Err: fmt.Errorf("more than %v pages of results", maxPages)}
+	}
+
+	switch len(matches) {
+	case 0:
+		return &LookupResult{Status: StatusNotFound}, nil
+	case 1:
+		return &LookupResult{Status: StatusMatched, Appearances: len(matches[0].Films), Planet: &matches[0]}, nil
+	default:
+		return &LookupResult{Status: StatusAmbiguous}, nil
+	}
+}
+
+// Pinger is implemented by the clients able to tell whether SWAPI answers
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping fetches the first page of planets, failing with an *UpstreamError when
+// SWAPI does not answer it
+func (client *HTTPClient) Ping(ctx context.Context) error {
+	_, err := client.getPlanets(ctx, client.BaseURL+"planets/")
+	return err
+}
+
+func (client *HTTPClient) getPlanets(ctx context.Context, pageURL string) (*PlanetResponse, error) {
+	swapiRes := PlanetResponse{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, &UpstreamError{Err: err}
+	}
+
+	res, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, &UpstreamError{Err: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &UpstreamError{StatusCode: res.StatusCode}
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&swapiRes)
+	if err != nil {
+		return nil, &UpstreamError{StatusCode: res.StatusCode, Err: err}
+	}
+
+	return &swapiRes, nil
+}
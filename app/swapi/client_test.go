@@ -0,0 +1,181 @@
+package swapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+	"github.com/Azuos0/b2w_challenge/app/swapi/swapitest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) *swapi.HTTPClient {
+	server := swapitest.NewServer()
+	t.Cleanup(server.Close)
+
+	return swapi.NewClient(server.URL, nil)
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	client := swapi.NewClient("", nil)
+
+	require.Equal(t, swapi.DefaultBaseURL, client.BaseURL)
+	require.Equal(t, swapi.DefaultTimeout, client.HTTPClient.Timeout)
+}
+
+func TestNewClientWithCustomTransport(t *testing.T) {
+	httpClient := &http.Client{Timeout: time.Second}
+	client := swapi.NewClient("http://swapi.local/api", httpClient)
+
+	require.Equal(t, "http://swapi.local/api/", client.BaseURL)
+	require.Equal(t, httpClient, client.HTTPClient)
+}
+
+func TestLookupExistentPlanet(t *testing.T) {
+	client := newTestClient(t)
+
+	res, err := client.LookupPlanet(context.Background(), "tatooine")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+	require.Equal(t, 5, res.Appearances)
+	require.Equal(t, "Tatooine", res.Planet.Name)
+}
+
+func TestLookupPlanetWithWhitespaceInName(t *testing.T) {
+	client := newTestClient(t)
+
+	res, err := client.LookupPlanet(context.Background(), "Yavin IV")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+	require.Equal(t, 1, res.Appearances)
+}
+
+func TestLookupPlanetAmongMultipleResults(t *testing.T) {
+	server := swapitest.NewServer(swapi.Planet{Name: "Naboo Moon"}, swapitest.Planets[7])
+	defer server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "naboo")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+	require.Equal(t, 4, res.Appearances)
+}
+
+func TestLookupPartialNameIsNotFound(t *testing.T) {
+	client := newTestClient(t)
+
+	res, err := client.LookupPlanet(context.Background(), "t")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusNotFound, res.Status)
+	require.Equal(t, 0, res.Appearances)
+}
+
+func TestLookupNonExistentPlanet(t *testing.T) {
+	client := newTestClient(t)
+
+	res, err := client.LookupPlanet(context.Background(), "DARTH VADER PLANET")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusNotFound, res.Status)
+	require.Nil(t, res.Planet)
+}
+
+func TestLookupAmbiguousPlanet(t *testing.T) {
+	server := swapitest.NewServer(swapitest.Planets[0], swapi.Planet{Name: "TATOOINE"})
+	defer server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "Tatooine")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusAmbiguous, res.Status)
+}
+
+func TestLookupFollowsNextPages(t *testing.T) {
+	planets := []swapi.Planet{}
+	for i := 0; i < 2*swapitest.PageSize; i++ {
+		planets = append(planets, swapi.Planet{Name: fmt.Sprintf("Planet %v", i)})
+	}
+	planets = append(planets, swapi.Planet{Name: "Planet", Films: []string{"film 1", "film 2"}})
+
+	server := swapitest.NewServer(planets...)
+	defer server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "planet")
+
+	require.Nil(t, err)
+	require.Equal(t, swapi.StatusMatched, res.Status)
+	require.Equal(t, 2, res.Appearances)
+}
+
+func TestLookupFailsOnEndlessPages(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next := server.URL + "/planets/?search=tatooine"
+		json.NewEncoder(w).Encode(swapi.PlanetResponse{Next: &next, Results: []swapi.Planet{}})
+	}))
+	defer server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "tatooine")
+
+	var upstreamErr *swapi.UpstreamError
+	require.True(t, errors.As(err, &upstreamErr))
+	require.Equal(t, swapi.StatusUpstreamError, res.Status)
+}
+
+func TestLookupUpstreamErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "tatooine")
+
+	var upstreamErr *swapi.UpstreamError
+	require.True(t, errors.As(err, &upstreamErr))
+	require.Equal(t, http.StatusBadGateway, upstreamErr.StatusCode)
+	require.Equal(t, swapi.StatusUpstreamError, res.Status)
+}
+
+func TestUnreachableServer(t *testing.T) {
+	server := swapitest.NewServer()
+	server.Close()
+	client := swapi.NewClient(server.URL, nil)
+
+	res, err := client.LookupPlanet(context.Background(), "tatooine")
+
+	require.Error(t, err)
+	require.Equal(t, swapi.StatusUpstreamError, res.Status)
+}
+
+func TestPing(t *testing.T) {
+	client := newTestClient(t)
+	require.Nil(t, client.Ping(context.Background()))
+
+	//the cache probes the client it wraps
+	cache := swapi.NewCachedClient(client, 0, 0, nil)
+	require.Nil(t, cache.Ping(context.Background()))
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	t.Cleanup(down.Close)
+
+	var upstream *swapi.UpstreamError
+	err := swapi.NewCachedClient(swapi.NewClient(down.URL, nil), 0, 0, nil).Ping(context.Background())
+	require.ErrorAs(t, err, &upstream)
+	require.Equal(t, http.StatusBadGateway, upstream.StatusCode)
+}
@@ -0,0 +1,54 @@
+package swapi
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCacheStore persists lookups on the swapi_cache collection
+type MongoCacheStore struct {
+	Collection *mongo.Collection
+}
+
+type cacheDocument struct {
+	Key       string       `bson:"_id"`
+	Result    LookupResult `bson:"result"`
+	ExpiresAt time.Time    `bson:"expiresAt"`
+}
+
+func NewMongoCacheStore(collection *mongo.Collection) *MongoCacheStore {
+	return &MongoCacheStore{
+		Collection: collection,
+	}
+}
+
+func (store *MongoCacheStore) Get(ctx context.Context, key string) (*LookupResult, time.Time, bool, error) {
+	doc := cacheDocument{}
+
+	err := store.Collection.FindOne(ctx, bson.M{"_id": key, "expiresAt": bson.M{"$gt": time.Now()}}).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		return nil, time.Time{}, false, nil
+	}
+
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	return &doc.Result, doc.ExpiresAt, true, nil
+}
+
+func (store *MongoCacheStore) Set(ctx context.Context, key string, result LookupResult, expiresAt time.Time) error {
+	doc := cacheDocument{
+		Key:       key,
+		Result:    result,
+		ExpiresAt: expiresAt,
+	}
+
+	_, err := store.Collection.ReplaceOne(ctx, bson.M{"_id": key}, doc, options.Replace().SetUpsert(true))
+
+	return err
+}
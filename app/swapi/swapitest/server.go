@@ -0,0 +1,135 @@
+// Package swapitest provides a fake SWAPI server for tests that must run offline
+package swapitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+
+	"github.com/Azuos0/b2w_challenge/app/swapi"
+)
+
+// PageSize is the number of planets per page, the same used by swapi.dev
+const PageSize = 10
+
+// Planets is a subset of the swapi.dev planets, used when NewServer is called
+// without planets
+var Planets = []swapi.Planet{
+	withAttributes(newPlanet("Tatooine", "arid", "desert", 5), "23", "304", "10465", "1 standard", "1", "200000"),
+	withAttributes(newPlanet("Alderaan", "temperate", "grasslands, mountains", 2), "24", "364", "12500", "1 standard", "40", "2000000000"),
+	newPlanet("Yavin IV", "temperate, tropical", "jungle, rainforests", 1),
+	withAttributes(newPlanet("Hoth", "frozen", "tundra, ice caves, mountain ranges", 1), "23", "549", "7200", "1.1 standard", "100", "unknown"),
+	newPlanet("Dagobah", "murky", "swamp, jungles", 3),
+	newPlanet("Bespin", "temperate", "gas giant", 1),
+	newPlanet("Endor", "temperate", "forests, mountains, lakes", 1),
+	newPlanet("Naboo", "temperate", "grassy hills, swamps, forests, mountains", 4),
+	newPlanet("Coruscant", "temperate", "cityscape, mountains", 4),
+	newPlanet("Kamino", "temperate", "ocean", 1),
+	newPlanet("Geonosis", "temperate, arid", "rock, desert, mountain, barren", 1),
+	newPlanet("Utapau", "temperate, arid, windy", "scrublands, savanna, canyons, sinkholes", 1),
+	newPlanet("Mustafar", "hot", "volcanoes, lava rivers, mountains, caves", 1),
+	newPlanet("Tund", "unknown", "barren, ash", 0),
+}
+
+func newPlanet(name string, climate string, terrain string, films int) swapi.Planet {
+	planet := swapi.Planet{
+		Name:           name,
+		RotationPeriod: "unknown",
+		OrbitalPeriod:  "unknown",
+		Diameter:       "unknown",
+		Climate:        climate,
+		Gravity:        "unknown",
+		Terrain:        terrain,
+		SurfaceWater:   "unknown",
+		Population:     "unknown",
+		Residents:      []string{},
+		Films:          []string{},
+	}
+
+	for i := 1; i <= films; i++ {
+		planet.Films = append(planet.Films, fmt.Sprintf("https://swapi.dev/api/films/%v/", i))
+	}
+
+	return planet
+}
+
+func withAttributes(planet swapi.Planet, rotationPeriod, orbitalPeriod, diameter, gravity, surfaceWater, population string) swapi.Planet {
+	planet.RotationPeriod = rotationPeriod
+	planet.OrbitalPeriod = orbitalPeriod
+	planet.Diameter = diameter
+	planet.Gravity = gravity
+	planet.SurfaceWater = surfaceWater
+	planet.Population = population
+
+	return planet
+}
+
+// NewServer starts a server answering /planets/?search=&page= the way swapi.dev
+// does. The caller must Close it when finished.
+func NewServer(planets ...swapi.Planet) *httptest.Server {
+	if len(planets) == 0 {
+		planets = Planets
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/planets/", func(w http.ResponseWriter, r *http.Request) {
+		search := r.URL.Query().Get("search")
+
+		page := 1
+		if r.URL.Query().Get("page") != "" {
+			var err error
+			page, err = strconv.Atoi(r.URL.Query().Get("page"))
+			if err != nil || page < 1 {
+				http.Error(w, `{"detail": "Not found"}`, http.StatusNotFound)
+				return
+			}
+		}
+
+		matches := []swapi.Planet{}
+		for _, planet := range planets {
+			if strings.Contains(strings.ToLower(planet.Name), strings.ToLower(search)) {
+				matches = append(matches, planet)
+			}
+		}
+
+		start := (page - 1) * PageSize
+		if start > 0 && start >= len(matches) {
+			http.Error(w, `{"detail": "Not found"}`, http.StatusNotFound)
+			return
+		}
+
+		end := start + PageSize
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		res := swapi.PlanetResponse{
+			Count:   len(matches),
+			Results: matches[start:end],
+		}
+
+		if page > 1 {
+			previous := pageURL(r, page-1)
+			res.Previous = &previous
+		}
+		if end < len(matches) {
+			next := pageURL(r, page+1)
+			res.Next = &next
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func pageURL(r *http.Request, page int) string {
+	query := r.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+
+	return fmt.Sprintf("http://%v%v?%v", r.Host, r.URL.Path, query.Encode())
+}
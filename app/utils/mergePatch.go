@@ -0,0 +1,41 @@
+package utils
+
+import "encoding/json"
+
+// MergePatch applies a JSON Merge Patch (RFC 7386) to the original document
+func MergePatch(original []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	var patchValue interface{}
+
+	if err := json.Unmarshal(original, &target); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(target, patchValue))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergeValue(targetObject[key], value)
+		}
+	}
+
+	return targetObject
+}
@@ -0,0 +1,31 @@
+package utils_test
+
+import (
+	"testing"
+
+	"github.com/Azuos0/b2w_challenge/app/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	original := []byte(`{"name": "Tatooine", "climate": "arid", "terrain": "desert", "nested": {"a": 1, "b": 2}}`)
+	patch := []byte(`{"climate": "temperate", "terrain": null, "nested": {"b": null, "c": 3}}`)
+
+	res, err := utils.MergePatch(original, patch)
+
+	require.Nil(t, err)
+	require.JSONEq(t, `{"name": "Tatooine", "climate": "temperate", "nested": {"a": 1, "c": 3}}`, string(res))
+}
+
+func TestMergePatchWithNonObjectPatch(t *testing.T) {
+	res, err := utils.MergePatch([]byte(`{"name": "Tatooine"}`), []byte(`["Tatooine"]`))
+
+	require.Nil(t, err)
+	require.JSONEq(t, `["Tatooine"]`, string(res))
+}
+
+func TestMergePatchWithInvalidJSON(t *testing.T) {
+	_, err := utils.MergePatch([]byte(`{"name": "Tatooine"}`), []byte(`{"name": `))
+
+	require.Error(t, err)
+}
@@ -5,8 +5,14 @@ import (
 	"net/http"
 )
 
-func RespondWithError(w http.ResponseWriter, code int, message string) {
-	RespondWithJSON(w, code, map[string]string{"error": message})
+// RespondWithProblem sends an error as an application/problem+json document,
+// as described by RFC 7807
+func RespondWithProblem(w http.ResponseWriter, code int, problem interface{}) {
+	response, _ := json.Marshal(problem)
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code)
+	w.Write(response)
 }
 
 func RespondWithJSON(w http.ResponseWriter, code int, payload interface{}) {